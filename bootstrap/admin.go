@@ -0,0 +1,154 @@
+package bootstrap
+
+import (
+	"net/http"
+	"net/url"
+	"regexp"
+	"runtime"
+	"runtime/debug"
+	"strings"
+
+	"github.com/go-chi/chi"
+	"github.com/go-chi/chi/middleware"
+)
+
+// build information, set on build time with
+// -ldflags "-X hypefast-api/bootstrap.Version=1.2.0 -X hypefast-api/bootstrap.Commit=abc123 -X hypefast-api/bootstrap.BuildDate=..."
+var (
+	Version   = "1.0"
+	Commit    = ""
+	BuildDate = ""
+)
+
+const redacted = "[REDACTED]"
+
+// secretKey config keys which value must not be shown in the config dump
+var secretKey = regexp.MustCompile(`(?i)(pass|secret|token|key|dsn|credential|auth)`)
+
+// secretKeys the config keys known to hold a secret whatever their name, * matches one segment
+var secretKeys = []string{
+	"log.*.source", // the Sentry DSN of SetupLogger
+	"db.psql_dsn",
+	"db.redis.password",
+	"aws.aws_key",
+	"aws.aws_secret",
+	"mail.mail_password",
+	"tracing.headers",
+}
+
+// BuildInfo the version of the running binary
+type BuildInfo struct {
+	Version   string            `json:"version"`
+	Commit    string            `json:"commit"`
+	BuildDate string            `json:"build_date"`
+	GoVersion string            `json:"go_version"`
+	Module    string            `json:"module"`
+	Deps      map[string]string `json:"deps"`
+}
+
+// AdminHandler the router of the admin listener:
+// /metrics, /health/live, /health/ready, /debug/pprof, /build-info and /config.
+// It must only be reachable from the internal network.
+func (app *App) AdminHandler() http.Handler {
+	r := chi.NewRouter()
+	r.Use(app.Recoverer)
+
+	if app.Config.GetBool("metrics.enabled") {
+		r.Method(http.MethodGet, "/metrics", app.MetricsHandler())
+	}
+
+	r.Route("/health", func(r chi.Router) {
+		r.Get("/live", app.LiveAction)
+		r.Get("/ready", app.ReadyAction)
+	})
+
+	r.Mount("/debug", middleware.Profiler())
+	r.Get("/build-info", app.BuildInfoAction)
+	r.Get("/config", app.ConfigAction)
+
+	return r
+}
+
+// BuildInfoAction give the version, commit and dependencies of the binary
+func (app *App) BuildInfoAction(w http.ResponseWriter, r *http.Request) {
+	info := BuildInfo{
+		Version:   Version,
+		Commit:    Commit,
+		BuildDate: BuildDate,
+		GoVersion: runtime.Version(),
+		Deps:      map[string]string{},
+	}
+
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		info.Module = bi.Main.Path
+		for _, dep := range bi.Deps {
+			info.Deps[dep.Path] = dep.Version
+		}
+	}
+
+	app.SendSuccessR(w, r, info, nil)
+}
+
+// ConfigAction give the runtime config with the secrets redacted
+func (app *App) ConfigAction(w http.ResponseWriter, r *http.Request) {
+	app.SendSuccessR(w, r, redactConfig("", app.Config.AllSettings()), nil)
+}
+
+// redactConfig copy the settings under the prefix, replacing the values of the secret keys
+// and the URLs holding credentials
+func redactConfig(prefix string, settings map[string]interface{}) map[string]interface{} {
+	result := make(map[string]interface{}, len(settings))
+	for k, v := range settings {
+		key := prefix + k
+		if secretKey.MatchString(k) || isSecretKey(key) {
+			result[k] = redacted
+			continue
+		}
+
+		result[k] = redactValue(key, v)
+	}
+
+	return result
+}
+
+func redactValue(key string, v interface{}) interface{} {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		return redactConfig(key+".", val)
+	case []interface{}:
+		list := make([]interface{}, 0, len(val))
+		for _, item := range val {
+			list = append(list, redactValue(key, item))
+		}
+		return list
+	case string:
+		if u, err := url.Parse(val); err == nil && u.User != nil && len(u.Host) > 0 {
+			return redacted
+		}
+	}
+
+	return v
+}
+
+// isSecretKey the dotted key is one of secretKeys
+func isSecretKey(key string) bool {
+	parts := strings.Split(strings.ToLower(key), ".")
+
+next:
+	for _, secret := range secretKeys {
+		segments := strings.Split(secret, ".")
+		if len(segments) != len(parts) {
+			continue
+		}
+
+		for i, seg := range segments {
+			if seg != "*" && seg != parts[i] {
+				continue next
+			}
+		}
+
+		return true
+	}
+
+	return false
+}
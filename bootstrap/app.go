@@ -7,7 +7,11 @@ import (
 	"log"
 	"net/http"
 
+	"hypefast-api/lib/cache"
+	"hypefast-api/lib/i18n"
 	"hypefast-api/lib/logger"
+	"hypefast-api/lib/psql"
+	"hypefast-api/lib/tracing"
 	"hypefast-api/lib/utils"
 
 	"cloud.google.com/go/firestore"
@@ -20,7 +24,8 @@ import (
 	enTranslations "github.com/go-playground/validator/v10/translations/en"
 	idTranslations "github.com/go-playground/validator/v10/translations/id"
 	"github.com/go-redis/redis/v8"
-	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
 	"golang.org/x/oauth2/google"
 	"google.golang.org/api/option"
 	"gopkg.in/Iwark/spreadsheet.v2"
@@ -30,12 +35,17 @@ import (
 type App struct {
 	Debug      bool
 	R          *chi.Mux
-	DB         *pgxpool.Pool
+	DB         *psql.DB
 	Config     utils.Config
 	Validator  *Validator
 	Log        logger.Contract
 	Redis      *redis.Client
 	RedisCache *redis.Client
+	Cache      *cache.Cache
+	I18n       *i18n.Catalog
+	Metrics    *prometheus.Registry
+	Tracing    *tracing.Provider
+	Health     *Health
 }
 
 // Validator set validator instance
@@ -55,15 +65,15 @@ func SetupValidator(config utils.Config) *Validator {
 	transID, _ := uni.GetTranslator("id")
 
 	validatorDriver := validator.New()
+	// the errors are reported by JSON path, see SendRequestValidationError
+	validatorDriver.RegisterTagNameFunc(jsonFieldName)
 
 	_ = enTranslations.RegisterDefaultTranslations(validatorDriver, transEN)
 	_ = idTranslations.RegisterDefaultTranslations(validatorDriver, transID)
+	registerDomainRules(validatorDriver, transEN, transID)
 
-	var trans ut.Translator
-	switch config.GetString("app.locale") {
-	case "en":
-		trans = transEN
-	case "id":
+	trans := transEN
+	if config.GetString("app.locale") == "id" {
 		trans = transID
 	}
 
@@ -79,6 +89,18 @@ func SetupLogger(config utils.Config) logger.Contract {
 	)
 }
 
+// SetupMetrics create the private prometheus registry of the app
+// with the Go runtime and process collectors registered.
+func SetupMetrics() *prometheus.Registry {
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+
+	return reg
+}
+
 // SetupRedis ...
 func SetupRedis(addr string, pass string, db int) (*redis.Client, error) {
 	rdb := redis.NewClient(&redis.Options{
@@ -90,25 +112,76 @@ func SetupRedis(addr string, pass string, db int) (*redis.Client, error) {
 	return rdb, nil
 }
 
+// SetupCache create the cache on the redis cache client,
+// `cache.refresh_ratio` is the part of the ttl left when a value is refreshed early.
+func SetupCache(client *redis.Client, config utils.Config) *cache.Cache {
+	if client == nil {
+		return nil
+	}
+
+	c := cache.New(client, config.GetString("cache.prefix"))
+	if config.GetString("cache.refresh_ratio") != "" {
+		c.SetRefreshRatio(config.GetFloat64("cache.refresh_ratio"))
+	}
+
+	return c
+}
+
+// Close release the resources of the app in order:
+// the database pool, the redis clients, the clients of the health checks, the tracer and the log sinks.
+func (app *App) Close(ctx context.Context) {
+	if app.DB != nil {
+		app.DB.Close()
+	}
+
+	if app.Redis != nil {
+		if err := app.Redis.Close(); err != nil {
+			log.Printf("[redis] %v", err)
+		}
+	}
+
+	if app.RedisCache != nil {
+		if err := app.RedisCache.Close(); err != nil {
+			log.Printf("[redis-cache] %v", err)
+		}
+	}
+
+	if app.Health != nil {
+		if err := app.Health.Close(); err != nil {
+			log.Printf("[health] %v", err)
+		}
+	}
+
+	if err := app.Tracing.Shutdown(ctx); err != nil {
+		log.Printf("[tracing] %v", err)
+	}
+
+	if app.Log != nil {
+		if err := app.Log.Close(); err != nil {
+			log.Printf("[log] %v", err)
+		}
+	}
+}
+
 // Firestore Connection
 func (app *App) FirestoreConn() *firestore.Client {
-	var (
-		err error
-	)
-
-	ctx := context.Background()
-	sa := option.WithCredentialsFile("firestore.json")
-	fbApp, err := firebase.NewApp(ctx, nil, sa)
+	fireStore, err := newFirestoreClient(context.Background())
 	if err != nil {
 		log.Fatalln(err)
 	}
 
-	fireStore, err := fbApp.Firestore(ctx)
+	return fireStore
+}
+
+// newFirestoreClient connect into firestore with the firestore.json credentials
+func newFirestoreClient(ctx context.Context) (*firestore.Client, error) {
+	sa := option.WithCredentialsFile("firestore.json")
+	fbApp, err := firebase.NewApp(ctx, nil, sa)
 	if err != nil {
-		log.Fatalln(err)
+		return nil, err
 	}
 
-	return fireStore
+	return fbApp.Firestore(ctx)
 }
 
 // GoogleSheet Connection
@@ -0,0 +1,682 @@
+package bootstrap
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"hypefast-api/lib/utils"
+
+	validator "github.com/go-playground/validator/v10"
+)
+
+const (
+	// MsgUnsupportedMediaType the request body content type is not supported
+	MsgUnsupportedMediaType = "ERR:UNSUPPORTED_MEDIA_TYPE"
+
+	dflMultipartMemory = 32 << 20
+)
+
+// the messages of the fields that cannot be decoded, [] is the field as in SendRequestValidationError
+const (
+	msgFieldUnknown = "[] is not a known field"
+	msgFieldInvalid = "[] has an invalid value"
+	msgFieldNumber  = "[] must be a number"
+	msgFieldBool    = "[] must be true or false"
+	msgFieldTime    = "[] must be a RFC 3339 time"
+	msgFieldString  = "[] must be a string"
+	msgFieldObject  = "[] must be an object"
+	msgFieldArray   = "[] must be an array"
+)
+
+var (
+	// ErrInvalidJSON the request body is not a single JSON value
+	ErrInvalidJSON = errors.New("invalid JSON body")
+
+	// ErrUnsupportedMediaType the request body content type cannot be decoded
+	ErrUnsupportedMediaType = errors.New("unsupported Content-Type")
+
+	fileHeaderType  = reflect.TypeOf((*multipart.FileHeader)(nil))
+	fileHeadersType = reflect.TypeOf([]*multipart.FileHeader(nil))
+	timeType        = reflect.TypeOf(time.Time{})
+)
+
+// FieldErrors the messages by field path of the fields that cannot be decoded
+type FieldErrors map[string][]string
+
+func (e FieldErrors) Error() string {
+	fields := make([]string, 0, len(e))
+	for f := range e {
+		fields = append(fields, f)
+	}
+	sort.Strings(fields)
+
+	return "invalid fields: " + strings.Join(fields, ", ")
+}
+
+func (e FieldErrors) add(field, message string) {
+	e[field] = append(e[field], message)
+}
+
+// Decode decode the request into dst, a pointer to a struct:
+//
+//   - the fields tagged `query:"name"` from the query string
+//   - the body by its Content-Type: JSON with the json tags, unknown fields and trailing data are refused,
+//     or an urlencoded or multipart form with the `form` tags (the json name when there is none),
+//     *multipart.FileHeader and []*multipart.FileHeader fields get the uploaded files,
+//     their temporary files are removed by RequestBodyMiddleware once the handler returns
+//   - the fields tagged `default:"value"` that the request does not set get their default,
+//     an explicit zero (or empty) value is kept and a JSON null is taken as not set
+//
+// The error is ErrBodyTooLarge, ErrInvalidJSON, ErrUnsupportedMediaType or FieldErrors,
+// which hold every field that cannot be decoded.
+func (h *App) Decode(r *http.Request, dst interface{}) error {
+	v := reflect.ValueOf(dst)
+	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Struct {
+		return errors.New("bind: dst must be a pointer to a struct")
+	}
+
+	errs := FieldErrors{}
+	present := map[string]bool{}
+	decodeValues(r.URL.Query(), nil, v.Elem(), "query", present, errs)
+
+	if err := h.decodeBody(r, v, present, errs); err != nil {
+		return err
+	}
+
+	applyDefaults(v.Elem(), "", present, errs)
+
+	if len(errs) > 0 {
+		return errs
+	}
+
+	return nil
+}
+
+// decodeBody decode the body into v, the fields set by the body are marked in present by JSON path
+func (h *App) decodeBody(r *http.Request, v reflect.Value, present map[string]bool, errs FieldErrors) error {
+	if r.Body == nil || r.Body == http.NoBody || r.ContentLength == 0 {
+		return nil
+	}
+
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil && len(r.Header.Get("Content-Type")) > 0 {
+		return ErrUnsupportedMediaType
+	}
+
+	switch mediaType {
+	case "", "application/json":
+		return decodeJSON(r.Body, v.Interface(), present, errs)
+	case "application/x-www-form-urlencoded":
+		if err := r.ParseForm(); err != nil {
+			return formError(err)
+		}
+		decodeValues(r.PostForm, nil, v.Elem(), "form", present, errs)
+	case "multipart/form-data":
+		mem := int64(h.Config.GetInt("bind.multipart_memory"))
+		if mem <= 0 {
+			mem = dflMultipartMemory
+		}
+		if err := r.ParseMultipartForm(mem); err != nil {
+			return formError(err)
+		}
+		if body, ok := r.Context().Value(bodyLimitCtxKey).(*limitedBody); ok {
+			body.form = r.MultipartForm
+		}
+		decodeValues(r.MultipartForm.Value, r.MultipartForm.File, v.Elem(), "form", present, errs)
+	default:
+		return ErrUnsupportedMediaType
+	}
+
+	return nil
+}
+
+func formError(err error) error {
+	if errors.Is(err, ErrBodyTooLarge) {
+		return ErrBodyTooLarge
+	}
+
+	return err
+}
+
+// decodeJSON decode a single JSON value into dst. The body is checked against the fields first
+// (see checkJSON), so every field of a wrong type or unknown is reported at once.
+func decodeJSON(body io.Reader, dst interface{}, present map[string]bool, errs FieldErrors) error {
+	data, err := ioutil.ReadAll(body)
+	if err != nil {
+		return formError(err)
+	}
+	if len(bytes.TrimSpace(data)) == 0 {
+		return nil
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	var raw interface{}
+	if err := dec.Decode(&raw); err != nil {
+		return ErrInvalidJSON
+	}
+	// a single value only, a trailing value is refused
+	var trailing json.RawMessage
+	if err := dec.Decode(&trailing); err != io.EOF {
+		return ErrInvalidJSON
+	}
+	if _, ok := raw.(map[string]interface{}); !ok && raw != nil {
+		return ErrInvalidJSON
+	}
+
+	bodyErrs := FieldErrors{}
+	checkJSON(raw, reflect.TypeOf(dst), "", present, bodyErrs)
+	if len(bodyErrs) > 0 {
+		for field, messages := range bodyErrs {
+			errs[field] = append(errs[field], messages...)
+		}
+		return errs
+	}
+
+	dec = json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	err = dec.Decode(dst)
+	if err == nil {
+		return nil
+	}
+
+	// the values checkJSON let through, e.g. the custom unmarshalers
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &typeErr):
+		errs.add(jsonPath(typeErr.Field), jsonTypeMessage(typeErr.Type))
+		return errs
+	case strings.HasPrefix(err.Error(), `json: unknown field "`):
+		errs.add(strings.TrimSuffix(strings.TrimPrefix(err.Error(), `json: unknown field "`), `"`), msgFieldUnknown)
+		return errs
+	}
+
+	return ErrInvalidJSON
+}
+
+// jsonField a field decoded from a JSON object, the fields of the embedded structs are flattened
+type jsonField struct {
+	// key the JSON key, matched case insensitively as encoding/json does
+	key string
+	// name the name of the field in the error paths
+	name   string
+	typ    reflect.Type
+	quoted bool
+}
+
+// jsonFields the fields of the struct t decoded from JSON
+func jsonFields(t reflect.Type) []jsonField {
+	var fields []jsonField
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" && !f.Anonymous {
+			continue
+		}
+
+		tag := strings.Split(f.Tag.Get("json"), ",")
+		if tag[0] == "-" && len(tag) == 1 {
+			continue
+		}
+
+		ft := f.Type
+		if ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		if f.Anonymous && len(tag[0]) == 0 && ft.Kind() == reflect.Struct {
+			fields = append(fields, jsonFields(ft)...)
+			continue
+		}
+		if f.PkgPath != "" {
+			continue
+		}
+
+		key := tag[0]
+		if len(key) == 0 {
+			key = f.Name
+		}
+		fields = append(fields, jsonField{key: key, name: jsonFieldName(f), typ: f.Type, quoted: containsString(tag[1:], "string")})
+	}
+
+	return fields
+}
+
+// matchJSONField the field of the key, the exact key first
+func matchJSONField(fields []jsonField, key string) (jsonField, bool) {
+	for _, f := range fields {
+		if f.key == key {
+			return f, true
+		}
+	}
+	for _, f := range fields {
+		if strings.EqualFold(f.key, key) {
+			return f, true
+		}
+	}
+
+	return jsonField{}, false
+}
+
+var (
+	jsonUnmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// checkJSON check the decoded JSON value (numbers as json.Number) against the type it is decoded into,
+// the errors are added by JSON path and the fields set with a value other than null are marked in present.
+// The types with their own unmarshaler are left to encoding/json.
+func checkJSON(raw interface{}, t reflect.Type, path string, present map[string]bool, errs FieldErrors) {
+	if raw == nil {
+		return
+	}
+
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	if t == timeType {
+		if s, ok := raw.(string); !ok {
+			errs.add(path, msgFieldTime)
+		} else if _, err := time.Parse(time.RFC3339, s); err != nil {
+			errs.add(path, msgFieldTime)
+		}
+		return
+	}
+
+	if t.Kind() == reflect.Interface || reflect.PtrTo(t).Implements(jsonUnmarshalerType) || reflect.PtrTo(t).Implements(textUnmarshalerType) {
+		return
+	}
+
+	switch value := raw.(type) {
+	case map[string]interface{}:
+		switch t.Kind() {
+		case reflect.Struct:
+			fields := jsonFields(t)
+			for key, item := range value {
+				f, ok := matchJSONField(fields, key)
+				if !ok {
+					errs.add(joinPath(path, key), msgFieldUnknown)
+					continue
+				}
+
+				fieldPath := joinPath(path, f.name)
+				if item != nil {
+					present[fieldPath] = true
+				}
+				if !f.quoted {
+					checkJSON(item, f.typ, fieldPath, present, errs)
+				}
+			}
+		case reflect.Map:
+			for key, item := range value {
+				checkJSON(item, t.Elem(), joinPath(path, key), present, errs)
+			}
+		default:
+			errs.add(path, jsonTypeMessage(t))
+		}
+	case []interface{}:
+		if t.Kind() != reflect.Slice && t.Kind() != reflect.Array {
+			errs.add(path, jsonTypeMessage(t))
+			return
+		}
+		for i, item := range value {
+			checkJSON(item, t.Elem(), path+"["+strconv.Itoa(i)+"]", present, errs)
+		}
+	case string:
+		// a []byte is decoded from base64
+		if t.Kind() != reflect.String && !(t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8) {
+			errs.add(path, jsonTypeMessage(t))
+		}
+	case bool:
+		if t.Kind() != reflect.Bool {
+			errs.add(path, jsonTypeMessage(t))
+		}
+	case json.Number:
+		if !numberFits(value, t) {
+			errs.add(path, jsonTypeMessage(t))
+		}
+	}
+}
+
+// numberFits can the number be decoded into the type, e.g. 1.5 or 300 do not fit an int8
+func numberFits(n json.Number, t reflect.Type) bool {
+	var err error
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		_, err = strconv.ParseInt(n.String(), 10, t.Bits())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		_, err = strconv.ParseUint(n.String(), 10, t.Bits())
+	case reflect.Float32, reflect.Float64:
+		_, err = strconv.ParseFloat(n.String(), t.Bits())
+	default:
+		return false
+	}
+
+	return err == nil
+}
+
+// joinPath the path of the member name of the object at path
+func joinPath(path, name string) string {
+	if len(path) == 0 {
+		return name
+	}
+
+	return path + "." + name
+}
+
+// jsonPath the path of encoding/json, e.g. items.0.qty, with the indexes in brackets: items[0].qty
+func jsonPath(field string) string {
+	parts := strings.Split(field, ".")
+
+	var b strings.Builder
+	for i, p := range parts {
+		if _, err := strconv.Atoi(p); err == nil && i > 0 {
+			b.WriteString("[" + p + "]")
+			continue
+		}
+		if b.Len() > 0 {
+			b.WriteByte('.')
+		}
+		b.WriteString(p)
+	}
+
+	return b.String()
+}
+
+func jsonTypeMessage(t reflect.Type) string {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return msgFieldNumber
+	case reflect.Bool:
+		return msgFieldBool
+	case reflect.String:
+		return msgFieldString
+	case reflect.Struct, reflect.Map:
+		if t == timeType {
+			return msgFieldTime
+		}
+		return msgFieldObject
+	case reflect.Slice, reflect.Array:
+		return msgFieldArray
+	}
+
+	return msgFieldInvalid
+}
+
+// fieldName the name of the field for the tag. A form field without tag has its json name,
+// or its Go name as encoding/json does. Empty when the field is not decoded with the tag.
+func fieldName(f reflect.StructField, tag string) string {
+	name := strings.Split(f.Tag.Get(tag), ",")[0]
+	if len(name) == 0 && tag == "form" {
+		name = strings.Split(f.Tag.Get("json"), ",")[0]
+		if len(name) == 0 {
+			name = f.Name
+		}
+	}
+	if name == "-" {
+		return ""
+	}
+
+	return name
+}
+
+// decodeValues set the fields of the struct v tagged with tag from the values and files,
+// the fields found are marked in present by JSON path
+func decodeValues(values url.Values, files map[string][]*multipart.FileHeader, v reflect.Value, tag string, present map[string]bool, errs FieldErrors) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		fv := v.Field(i)
+		if f.PkgPath != "" && !f.Anonymous {
+			continue
+		}
+
+		if f.Anonymous && f.Type.Kind() == reflect.Struct {
+			decodeValues(values, files, fv, tag, present, errs)
+			continue
+		}
+
+		name := fieldName(f, tag)
+		if len(name) == 0 {
+			continue
+		}
+
+		switch f.Type {
+		case fileHeaderType:
+			if fhs := files[name]; len(fhs) > 0 {
+				fv.Set(reflect.ValueOf(fhs[0]))
+				present[jsonFieldName(f)] = true
+			}
+			continue
+		case fileHeadersType:
+			if fhs := files[name]; len(fhs) > 0 {
+				fv.Set(reflect.ValueOf(fhs))
+				present[jsonFieldName(f)] = true
+			}
+			continue
+		}
+
+		raw, ok := values[name]
+		if !ok {
+			continue
+		}
+		present[jsonFieldName(f)] = true
+
+		if err := setValues(fv, raw); err != nil {
+			errs.add(name, err.Error())
+		}
+	}
+}
+
+// setValues set a field from its string values, a slice get all of them
+func setValues(v reflect.Value, raw []string) error {
+	if v.Kind() == reflect.Slice && v.Type().Elem().Kind() != reflect.Uint8 {
+		s := reflect.MakeSlice(v.Type(), len(raw), len(raw))
+		for i, r := range raw {
+			if err := setValue(s.Index(i), r); err != nil {
+				return err
+			}
+		}
+		v.Set(s)
+
+		return nil
+	}
+
+	if len(raw) == 0 {
+		return nil
+	}
+
+	return setValue(v, raw[0])
+}
+
+// setValue set a scalar field from a string, the error is the message of the field
+func setValue(v reflect.Value, raw string) error {
+	if v.Kind() == reflect.Ptr {
+		p := reflect.New(v.Type().Elem())
+		if err := setValue(p.Elem(), raw); err != nil {
+			return err
+		}
+		v.Set(p)
+
+		return nil
+	}
+
+	if v.Type() == timeType {
+		t, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			return errors.New(msgFieldTime)
+		}
+		v.Set(reflect.ValueOf(t))
+
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(raw)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return errors.New(msgFieldBool)
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if v.Type() == reflect.TypeOf(time.Duration(0)) {
+			d, err := time.ParseDuration(raw)
+			if err != nil {
+				return errors.New(msgFieldInvalid)
+			}
+			v.SetInt(int64(d))
+			return nil
+		}
+		n, err := strconv.ParseInt(raw, 10, v.Type().Bits())
+		if err != nil {
+			return errors.New(msgFieldNumber)
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(raw, 10, v.Type().Bits())
+		if err != nil {
+			return errors.New(msgFieldNumber)
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		n, err := strconv.ParseFloat(raw, v.Type().Bits())
+		if err != nil {
+			return errors.New(msgFieldNumber)
+		}
+		v.SetFloat(n)
+	default:
+		return errors.New(msgFieldInvalid)
+	}
+
+	return nil
+}
+
+// applyDefaults set the fields tagged `default:"value"` which are not in present and still zero,
+// in the nested structs and slices of structs too
+func applyDefaults(v reflect.Value, prefix string, present map[string]bool, errs FieldErrors) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		fv := v.Field(i)
+		if f.PkgPath != "" && !f.Anonymous {
+			continue
+		}
+
+		path := prefix + jsonFieldName(f)
+		if dfl, ok := f.Tag.Lookup("default"); ok && !present[path] && fv.IsZero() {
+			values := []string{dfl}
+			if fv.Kind() == reflect.Slice {
+				values = strings.Split(dfl, ",")
+			}
+			if err := setValues(fv, values); err != nil {
+				errs.add(path, err.Error())
+			}
+			continue
+		}
+
+		switch {
+		case fv.Kind() == reflect.Struct && fv.Type() != timeType:
+			if f.Anonymous {
+				applyDefaults(fv, prefix, present, errs)
+			} else {
+				applyDefaults(fv, path+".", present, errs)
+			}
+		case fv.Kind() == reflect.Ptr && !fv.IsNil() && fv.Elem().Kind() == reflect.Struct && fv.Elem().Type() != timeType:
+			applyDefaults(fv.Elem(), path+".", present, errs)
+		case fv.Kind() == reflect.Slice && fv.Type().Elem().Kind() == reflect.Struct && fv.Type().Elem() != timeType:
+			for j := 0; j < fv.Len(); j++ {
+				applyDefaults(fv.Index(j), path+"["+strconv.Itoa(j)+"].", present, errs)
+			}
+		}
+	}
+}
+
+// jsonFieldName the name of the field in the JSON path of the errors:
+// its json name, or its underscored name when it has none
+func jsonFieldName(f reflect.StructField) string {
+	name := strings.Split(f.Tag.Get("json"), ",")[0]
+	if name == "-" || len(name) == 0 {
+		return utils.Underscore(f.Name)
+	}
+
+	return name
+}
+
+// fieldPath the JSON path of the field of a validation error, e.g. items[0].sku
+func fieldPath(err validator.FieldError) string {
+	ns := err.Namespace()
+	if i := strings.Index(ns, "."); i >= 0 {
+		return ns[i+1:]
+	}
+
+	return ns
+}
+
+// BindAndValidate decode the request into dst (see Decode) and validate it with App.Validator.
+// When it fails the error response is already sent and false is returned:
+// 413 when the body is too large, 415 for an unsupported Content-Type, 400 ERR:BAD_REQUEST
+// for a malformed body, and 400 ERR:VALIDATION with the messages by JSON path for the invalid fields.
+//
+//	var req request.CreateOrder
+//	if !h.BindAndValidate(w, r, &req) {
+//		return
+//	}
+func (h *App) BindAndValidate(w http.ResponseWriter, r *http.Request, dst interface{}) bool {
+	err := h.Decode(r, dst)
+	if err == nil {
+		err = h.Validator.Driver.StructCtx(r.Context(), dst)
+	}
+	if err == nil {
+		return true
+	}
+
+	var fieldErrs FieldErrors
+	var validationErrs validator.ValidationErrors
+	switch {
+	case errors.As(err, &validationErrs):
+		h.SendRequestValidationErrorR(w, r, validationErrs)
+	case errors.As(err, &fieldErrs):
+		h.sendFieldErrors(w, r, fieldErrs)
+	case errors.Is(err, ErrUnsupportedMediaType):
+		h.RespondWithJSONR(w, r, http.StatusUnsupportedMediaType, MsgUnsupportedMediaType, h.T(r, "unsupported Content-Type %s", r.Header.Get("Content-Type")), h.EmptyJSONArr(), h.EmptyJSONArr())
+	case errors.Is(err, ErrBodyTooLarge):
+		h.SendRequestTooLargeR(w, r)
+	default:
+		h.SendBadRequestR(w, r, h.T(r, err.Error()))
+	}
+
+	return false
+}
+
+// sendFieldErrors send the fields that cannot be decoded like the validation errors
+func (h *App) sendFieldErrors(w http.ResponseWriter, r *http.Request, errs FieldErrors) {
+	resp := make(map[string][]string, len(errs))
+	for field, messages := range errs {
+		for _, m := range messages {
+			resp[field] = append(resp[field], h.T(r, m))
+		}
+	}
+
+	h.RespondWithJSONR(w, r, http.StatusBadRequest, MsgErrValidation, "validation error", resp, h.EmptyJSONArr())
+}
@@ -0,0 +1,67 @@
+package bootstrap
+
+import (
+	"bytes"
+	"context"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestDecodeMultipartRemovesTheTemporaryFiles(t *testing.T) {
+	// every uploaded file is kept on disk
+	app := newConfigApp(t, `{"bind": {"multipart_memory": 1}}`)
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	_ = mw.WriteField("name", "invoice")
+	fw, _ := mw.CreateFormFile("file", "invoice.csv")
+	_, _ = fw.Write([]byte(strings.Repeat("a,b\n", 256)))
+	_ = mw.Close()
+
+	var tmpfile string
+	handler := app.RequestBodyMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// a middleware in between hand a copy of the request to the handler
+		r = r.WithContext(context.WithValue(r.Context(), "mcode", "m1"))
+
+		var req struct {
+			Name string                `form:"name"`
+			File *multipart.FileHeader `form:"file"`
+		}
+		if err := app.Decode(r, &req); err != nil {
+			t.Fatal(err)
+		}
+		if req.Name != "invoice" || req.File == nil {
+			t.Fatalf("decoded %+v", req)
+		}
+
+		f, err := req.File.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+
+		osFile, ok := f.(*os.File)
+		if !ok {
+			t.Fatalf("the upload is kept in memory (%T)", f)
+		}
+		tmpfile = osFile.Name()
+
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	r := httptest.NewRequest(http.MethodPost, "/v1/api/invoices", &body)
+	r.Header.Set("Content-Type", mw.FormDataContentType())
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, r)
+
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("status = %d, want 204: %s", rec.Code, rec.Body.String())
+	}
+	if _, err := os.Stat(tmpfile); !os.IsNotExist(err) {
+		t.Errorf("the temporary file %s is still there (%v)", tmpfile, err)
+	}
+}
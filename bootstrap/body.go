@@ -0,0 +1,160 @@
+package bootstrap
+
+import (
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"strings"
+)
+
+const (
+	// MsgRequestTooLarge the request body is over the size limit
+	MsgRequestTooLarge = "ERR:REQUEST_TOO_LARGE"
+
+	// MsgUnsupportedEncoding the request body encoding is not supported
+	MsgUnsupportedEncoding = "ERR:UNSUPPORTED_ENCODING"
+
+	dflMaxBodyBytes = 1 << 20
+
+	bodyLimitCtxKey = "body_limit"
+)
+
+// ErrBodyTooLarge the request body is over the size limit of the route
+var ErrBodyTooLarge = errors.New("request body too large")
+
+// limitedBody fail with ErrBodyTooLarge when the declared length is over max
+// or once more than max bytes are read, the limit can be changed by a route until the body is read
+type limitedBody struct {
+	body     io.ReadCloser
+	declared int64
+	max      int64
+	read     int64
+
+	// form the multipart form parsed by Decode, its temporary files are removed after the handler
+	form *multipart.Form
+}
+
+func (l *limitedBody) Read(p []byte) (int, error) {
+	if l.read > l.max || l.declared > l.max {
+		return 0, ErrBodyTooLarge
+	}
+
+	// read one byte over the limit to know the body is too large
+	if left := l.max - l.read + 1; int64(len(p)) > left {
+		p = p[:left]
+	}
+
+	n, err := l.body.Read(p)
+	l.read += int64(n)
+	if l.read > l.max {
+		return n, ErrBodyTooLarge
+	}
+
+	return n, err
+}
+
+func (l *limitedBody) Close() error {
+	return l.body.Close()
+}
+
+// removeForm remove the temporary files of the multipart form. net/http only remove the ones of
+// the request it gave to the handler, not those of a form parsed on a copy made by WithContext.
+func (l *limitedBody) removeForm() {
+	if l.form != nil {
+		_ = l.form.RemoveAll()
+	}
+}
+
+// RequestBodyMiddleware decode the gzip request bodies and cap the body size at `body_limit.max_bytes`
+// (default 1MB), counted on the decoded body. Reading a bigger body fail with ErrBodyTooLarge,
+// the handler send it with SendBindErrorR. Use BodyLimit to change the limit of a route.
+// The temporary files of a multipart form parsed by Decode are removed once the handler returns.
+func (app *App) RequestBodyMiddleware(next http.Handler) http.Handler {
+	max := int64(app.Config.GetInt("body_limit.max_bytes"))
+	if max <= 0 {
+		max = dflMaxBodyBytes
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Body == nil || r.Body == http.NoBody {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		switch encoding := strings.ToLower(strings.TrimSpace(r.Header.Get("Content-Encoding"))); encoding {
+		case "", "identity":
+		case encodingGzip:
+			gz, err := gzip.NewReader(r.Body)
+			if err != nil {
+				app.SendBadRequestR(w, r, "invalid gzip request body")
+				return
+			}
+			r.Body = gz
+			r.ContentLength = -1
+			r.Header.Del("Content-Encoding")
+			r.Header.Del("Content-Length")
+		default:
+			app.RespondWithJSONR(w, r, http.StatusUnsupportedMediaType, MsgUnsupportedEncoding, app.T(r, "unsupported Content-Encoding %s", encoding), app.EmptyJSONArr(), app.EmptyJSONArr())
+			return
+		}
+
+		body := &limitedBody{body: r.Body, declared: r.ContentLength, max: max}
+		r.Body = body
+		defer body.removeForm()
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), bodyLimitCtxKey, body)))
+	})
+}
+
+// BodyLimit change the maximum body size of the routes, a body declared bigger get 413.
+// To be mounted on a route group under RequestBodyMiddleware, e.g. r.With(app.BodyLimit(10 << 20)).Post("/upload", h.Upload)
+func (app *App) BodyLimit(max int64) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.ContentLength > max {
+				app.SendRequestTooLargeR(w, r)
+				return
+			}
+
+			if body, ok := r.Context().Value(bodyLimitCtxKey).(*limitedBody); ok {
+				body.max = max
+			} else if r.Body != nil && r.Body != http.NoBody {
+				r.Body = &limitedBody{body: r.Body, declared: r.ContentLength, max: max}
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// SendRequestTooLarge send the body too large error into response with 413 http code.
+//
+// Deprecated: use SendRequestTooLargeR, which answer in the language of the request.
+func (h *App) SendRequestTooLarge(w http.ResponseWriter) {
+	h.SendRequestTooLargeR(w, nil)
+}
+
+// SendRequestTooLargeR send the body too large error into response with 413 http code.
+func (h *App) SendRequestTooLargeR(w http.ResponseWriter, r *http.Request) {
+	h.RespondWithJSONR(w, r, http.StatusRequestEntityTooLarge, MsgRequestTooLarge, "request body too large", h.EmptyJSONArr(), h.EmptyJSONArr())
+}
+
+// SendBindError send the error of Bind, 413 when the body is too large otherwise 400
+//
+// Deprecated: use SendBindErrorR, which answer in the language of the request.
+func (h *App) SendBindError(w http.ResponseWriter, err error) {
+	h.SendBindErrorR(w, nil, err)
+}
+
+// SendBindErrorR send the error of Bind, 413 when the body is too large otherwise 400
+func (h *App) SendBindErrorR(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, ErrBodyTooLarge) {
+		h.SendRequestTooLargeR(w, r)
+		return
+	}
+
+	h.SendBadRequestR(w, r, err.Error())
+}
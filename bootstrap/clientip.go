@@ -0,0 +1,104 @@
+package bootstrap
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// clientIPCtxKey context key of the client address resolved by RealIPMiddleware
+const clientIPCtxKey = "client_ip"
+
+// trustedProxies parse `server.trusted_proxies`, a list of addresses or CIDR ranges
+func (app *App) trustedProxies() []*net.IPNet {
+	var nets []*net.IPNet
+	for _, proxy := range app.Config.GetStringSlice("server.trusted_proxies") {
+		proxy = strings.TrimSpace(proxy)
+		if !strings.Contains(proxy, "/") {
+			if ip := net.ParseIP(proxy); ip != nil && ip.To4() != nil {
+				proxy += "/32"
+			} else {
+				proxy += "/128"
+			}
+		}
+
+		_, ipNet, err := net.ParseCIDR(proxy)
+		if err != nil {
+			panic(fmt.Sprintf("server.trusted_proxies: invalid address %q", proxy))
+		}
+		nets = append(nets, ipNet)
+	}
+
+	return nets
+}
+
+// RealIPMiddleware resolve the address of the client and put it into the request context, read it with clientIP.
+// X-Forwarded-For is only read when the peer is one of `server.trusted_proxies`: the client is the
+// right-most address of the header that is not a trusted proxy, so an address the client put
+// in the header itself is never used. Without trusted proxies the client is the peer.
+func (app *App) RealIPMiddleware(next http.Handler) http.Handler {
+	trusted := app.trustedProxies()
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ip := resolveClientIP(r, trusted)
+		next.ServeHTTP(w, r.WithContext(userContext(r.Context(), clientIPCtxKey, ip)))
+	})
+}
+
+// resolveClientIP walk X-Forwarded-For from the peer towards the client while the hops are trusted
+func resolveClientIP(r *http.Request, trusted []*net.IPNet) string {
+	ip := remoteHost(r)
+	if !isTrustedProxy(ip, trusted) {
+		return ip
+	}
+
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if net.ParseIP(hop) == nil {
+			break
+		}
+
+		ip = hop
+		if !isTrustedProxy(hop, trusted) {
+			break
+		}
+	}
+
+	return ip
+}
+
+func isTrustedProxy(ip string, trusted []*net.IPNet) bool {
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return false
+	}
+
+	for _, n := range trusted {
+		if n.Contains(addr) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// clientIP the address of the client resolved by RealIPMiddleware, fallback into the peer address
+func clientIP(r *http.Request) string {
+	if ip, ok := r.Context().Value(clientIPCtxKey).(string); ok && len(ip) > 0 {
+		return ip
+	}
+
+	return remoteHost(r)
+}
+
+// remoteHost the host of the peer address
+func remoteHost(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
@@ -0,0 +1,281 @@
+package bootstrap
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"hypefast-api/lib/psql"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	queryLatencyName = "db_query_duration_milliseconds"
+	redisLatencyName = "redis_command_duration_milliseconds"
+	cacheRequestName = "cache_requests_total"
+
+	statusOK    = "ok"
+	statusError = "error"
+
+	// cacheGroupOther the group of the cache keys without a "group:" prefix
+	cacheGroupOther = "other"
+)
+
+var dflStorageBuckets = []float64{1, 5, 10, 25, 50, 100, 250, 500, 1000, 2500}
+
+// InstrumentStorage register the collectors of App.DB, App.Redis, App.RedisCache and App.Cache
+// and hook the per query/command latency histograms and the cache hit/miss counter into them.
+func (app *App) InstrumentStorage() {
+	if app.DB != nil {
+		app.registerCollector(newPgxPoolCollector(app.DB.Pool))
+
+		latency := app.registerCollector(prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    queryLatencyName,
+			Help:    "How long it took to run the named query, partitioned by query name and status.",
+			Buckets: dflStorageBuckets,
+		}, []string{"query", "status"})).(*prometheus.HistogramVec)
+		app.DB.AddHook(queryMetricsHook{latency: latency})
+	}
+
+	if app.Cache != nil {
+		requests := app.registerCollector(prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: cacheRequestName,
+			Help: "How many cache lookups were made, partitioned by key group and result (hit or miss).",
+		}, []string{"group", "result"})).(*prometheus.CounterVec)
+		app.Cache.AddHook(cacheMetricsHook{requests: requests})
+	}
+
+	clients := map[string]*redis.Client{}
+	if app.Redis != nil {
+		clients["default"] = app.Redis
+	}
+	if app.RedisCache != nil {
+		clients["cache"] = app.RedisCache
+	}
+	if len(clients) == 0 {
+		return
+	}
+
+	app.registerCollector(newRedisPoolCollector(clients))
+	latency := app.registerCollector(prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    redisLatencyName,
+		Help:    "How long it took to run the redis command, partitioned by client, command and status.",
+		Buckets: dflStorageBuckets,
+	}, []string{"client", "command", "status"})).(*prometheus.HistogramVec)
+	for name, client := range clients {
+		client.AddHook(redisMetricsHook{client: name, latency: latency})
+	}
+}
+
+func sinceMillis(start time.Time) float64 {
+	return float64(time.Since(start).Nanoseconds()) / 1000000
+}
+
+// pgx section
+
+// pgxPoolCollector expose the pgxpool stats on every scrape
+type pgxPoolCollector struct {
+	pool *pgxpool.Pool
+
+	acquired        *prometheus.Desc
+	idle            *prometheus.Desc
+	constructing    *prometheus.Desc
+	total           *prometheus.Desc
+	max             *prometheus.Desc
+	acquireCount    *prometheus.Desc
+	acquireDuration *prometheus.Desc
+	waitCount       *prometheus.Desc
+	canceledCount   *prometheus.Desc
+}
+
+func newPgxPoolCollector(pool *pgxpool.Pool) *pgxPoolCollector {
+	desc := func(name, help string) *prometheus.Desc {
+		return prometheus.NewDesc("pgxpool_"+name, help, nil, nil)
+	}
+
+	return &pgxPoolCollector{
+		pool:            pool,
+		acquired:        desc("acquired_conns", "Number of currently acquired connections in the pool."),
+		idle:            desc("idle_conns", "Number of currently idle connections in the pool."),
+		constructing:    desc("constructing_conns", "Number of connections with construction in progress in the pool."),
+		total:           desc("total_conns", "Total number of resources currently in the pool."),
+		max:             desc("max_conns", "Maximum size of the pool."),
+		acquireCount:    desc("acquire_total", "Cumulative count of successful acquires from the pool."),
+		acquireDuration: desc("acquire_duration_seconds_total", "Total duration of all successful acquires from the pool."),
+		waitCount:       desc("wait_total", "Cumulative count of acquires that waited for a resource to be released or constructed."),
+		canceledCount:   desc("canceled_acquire_total", "Cumulative count of acquires from the pool that were canceled by a context."),
+	}
+}
+
+// Describe implement prometheus.Collector
+func (c *pgxPoolCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.acquired
+	ch <- c.idle
+	ch <- c.constructing
+	ch <- c.total
+	ch <- c.max
+	ch <- c.acquireCount
+	ch <- c.acquireDuration
+	ch <- c.waitCount
+	ch <- c.canceledCount
+}
+
+// Collect implement prometheus.Collector
+func (c *pgxPoolCollector) Collect(ch chan<- prometheus.Metric) {
+	stat := c.pool.Stat()
+
+	ch <- prometheus.MustNewConstMetric(c.acquired, prometheus.GaugeValue, float64(stat.AcquiredConns()))
+	ch <- prometheus.MustNewConstMetric(c.idle, prometheus.GaugeValue, float64(stat.IdleConns()))
+	ch <- prometheus.MustNewConstMetric(c.constructing, prometheus.GaugeValue, float64(stat.ConstructingConns()))
+	ch <- prometheus.MustNewConstMetric(c.total, prometheus.GaugeValue, float64(stat.TotalConns()))
+	ch <- prometheus.MustNewConstMetric(c.max, prometheus.GaugeValue, float64(stat.MaxConns()))
+	ch <- prometheus.MustNewConstMetric(c.acquireCount, prometheus.CounterValue, float64(stat.AcquireCount()))
+	ch <- prometheus.MustNewConstMetric(c.acquireDuration, prometheus.CounterValue, stat.AcquireDuration().Seconds())
+	ch <- prometheus.MustNewConstMetric(c.waitCount, prometheus.CounterValue, float64(stat.EmptyAcquireCount()))
+	ch <- prometheus.MustNewConstMetric(c.canceledCount, prometheus.CounterValue, float64(stat.CanceledAcquireCount()))
+}
+
+// queryMetricsHook observe the latency of the named queries of App.DB
+type queryMetricsHook struct {
+	latency *prometheus.HistogramVec
+}
+
+func (h queryMetricsHook) BeforeQuery(ctx context.Context, q psql.QueryInfo) context.Context {
+	return ctx
+}
+
+func (h queryMetricsHook) AfterQuery(ctx context.Context, q psql.QueryInfo, err error) {
+	status := statusOK
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		status = statusError
+	}
+
+	h.latency.WithLabelValues(q.Name, status).Observe(sinceMillis(q.Start))
+}
+
+// redis section
+
+// redisPoolCollector expose the go-redis pool stats of every client on every scrape
+type redisPoolCollector struct {
+	clients map[string]*redis.Client
+
+	hits     *prometheus.Desc
+	misses   *prometheus.Desc
+	timeouts *prometheus.Desc
+	total    *prometheus.Desc
+	idle     *prometheus.Desc
+	stale    *prometheus.Desc
+}
+
+func newRedisPoolCollector(clients map[string]*redis.Client) *redisPoolCollector {
+	desc := func(name, help string) *prometheus.Desc {
+		return prometheus.NewDesc("redis_pool_"+name, help, []string{"client"}, nil)
+	}
+
+	return &redisPoolCollector{
+		clients:  clients,
+		hits:     desc("hits_total", "Number of times free connection was found in the pool."),
+		misses:   desc("misses_total", "Number of times free connection was NOT found in the pool."),
+		timeouts: desc("timeouts_total", "Number of times a wait timeout occurred."),
+		total:    desc("total_conns", "Number of total connections in the pool."),
+		idle:     desc("idle_conns", "Number of idle connections in the pool."),
+		stale:    desc("stale_conns_total", "Number of stale connections removed from the pool."),
+	}
+}
+
+// Describe implement prometheus.Collector
+func (c *redisPoolCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.hits
+	ch <- c.misses
+	ch <- c.timeouts
+	ch <- c.total
+	ch <- c.idle
+	ch <- c.stale
+}
+
+// Collect implement prometheus.Collector
+func (c *redisPoolCollector) Collect(ch chan<- prometheus.Metric) {
+	for name, client := range c.clients {
+		stat := client.PoolStats()
+
+		ch <- prometheus.MustNewConstMetric(c.hits, prometheus.CounterValue, float64(stat.Hits), name)
+		ch <- prometheus.MustNewConstMetric(c.misses, prometheus.CounterValue, float64(stat.Misses), name)
+		ch <- prometheus.MustNewConstMetric(c.timeouts, prometheus.CounterValue, float64(stat.Timeouts), name)
+		ch <- prometheus.MustNewConstMetric(c.total, prometheus.GaugeValue, float64(stat.TotalConns), name)
+		ch <- prometheus.MustNewConstMetric(c.idle, prometheus.GaugeValue, float64(stat.IdleConns), name)
+		ch <- prometheus.MustNewConstMetric(c.stale, prometheus.CounterValue, float64(stat.StaleConns), name)
+	}
+}
+
+type redisStartKey struct{}
+
+// redisMetricsHook observe the latency of every command of one redis client
+type redisMetricsHook struct {
+	client  string
+	latency *prometheus.HistogramVec
+}
+
+func (h redisMetricsHook) BeforeProcess(ctx context.Context, cmd redis.Cmder) (context.Context, error) {
+	return context.WithValue(ctx, redisStartKey{}, time.Now()), nil
+}
+
+func (h redisMetricsHook) AfterProcess(ctx context.Context, cmd redis.Cmder) error {
+	h.observe(ctx, cmd.Name(), cmd.Err())
+	return nil
+}
+
+func (h redisMetricsHook) BeforeProcessPipeline(ctx context.Context, cmds []redis.Cmder) (context.Context, error) {
+	return context.WithValue(ctx, redisStartKey{}, time.Now()), nil
+}
+
+func (h redisMetricsHook) AfterProcessPipeline(ctx context.Context, cmds []redis.Cmder) error {
+	var err error
+	for _, cmd := range cmds {
+		if cmd.Err() != nil && cmd.Err() != redis.Nil {
+			err = cmd.Err()
+			break
+		}
+	}
+	h.observe(ctx, "pipeline", err)
+
+	return nil
+}
+
+func (h redisMetricsHook) observe(ctx context.Context, command string, err error) {
+	start, ok := ctx.Value(redisStartKey{}).(time.Time)
+	if !ok {
+		return
+	}
+
+	status := statusOK
+	if err != nil && err != redis.Nil {
+		status = statusError
+	}
+
+	h.latency.WithLabelValues(h.client, strings.ToLower(command), status).Observe(sinceMillis(start))
+}
+
+// cacheMetricsHook count the cache lookups by the group of the key, the part before the first ":",
+// the keys without a group are counted as "other" so a key per entity does not make a series per entity
+type cacheMetricsHook struct {
+	requests *prometheus.CounterVec
+}
+
+func (h cacheMetricsHook) Observe(ctx context.Context, key string, hit bool) {
+	group := cacheGroupOther
+	if i := strings.IndexByte(key, ':'); i > 0 {
+		group = key[:i]
+	}
+
+	result := "miss"
+	if hit {
+		result = "hit"
+	}
+
+	h.requests.WithLabelValues(group, result).Inc()
+}
@@ -0,0 +1,332 @@
+package bootstrap
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+)
+
+const (
+	encodingBrotli = "br"
+	encodingGzip   = "gzip"
+
+	dflCompressMinSize = 1024
+	dflCompressLevel   = gzip.DefaultCompression
+)
+
+// dflCompressTypes the content types compressed when `compress.types` is empty
+var dflCompressTypes = []string{
+	"application/json",
+	"application/problem+json",
+	"application/xml",
+	"text/plain",
+	"text/html",
+	"text/csv",
+}
+
+// compressor the settings of CompressMiddleware
+type compressor struct {
+	level   int
+	minSize int
+	types   map[string]bool
+
+	gzipPool sync.Pool
+}
+
+// CompressMiddleware compress the responses with the encoding negotiated by Accept-Encoding (br or gzip).
+// Only the content types of `compress.types` are compressed, and only when the body
+// is at least `compress.min_size` bytes (default 1024), `compress.level` is the gzip/brotli level.
+// The strong ETag of a compressed response get the encoding as suffix (see encodedETag).
+func (app *App) CompressMiddleware() func(http.Handler) http.Handler {
+	c := &compressor{
+		level:   dflCompressLevel,
+		minSize: dflCompressMinSize,
+		types:   map[string]bool{},
+	}
+	if app.Config.GetString("compress.level") != "" {
+		c.level = app.Config.GetInt("compress.level")
+	}
+	if app.Config.GetString("compress.min_size") != "" {
+		c.minSize = app.Config.GetInt("compress.min_size")
+	}
+
+	types := app.Config.GetStringSlice("compress.types")
+	if len(types) == 0 {
+		types = dflCompressTypes
+	}
+	for _, t := range types {
+		c.types[strings.ToLower(t)] = true
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			encoding := negotiateEncoding(r.Header.Get("Accept-Encoding"))
+			if len(encoding) == 0 || r.Method == http.MethodHead {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			w.Header().Add("Vary", "Accept-Encoding")
+
+			cw := &compressWriter{ResponseWriter: w, c: c, encoding: encoding, status: http.StatusOK,
+				ifNoneMatch: r.Header.Get("If-None-Match")}
+			defer cw.Close()
+
+			next.ServeHTTP(cw, r)
+		})
+	}
+}
+
+// negotiateEncoding the supported encoding with the highest quality, brotli wins a tie
+func negotiateEncoding(accept string) string {
+	best, bestQ := "", 0.0
+	for _, part := range strings.Split(accept, ",") {
+		fields := strings.Split(strings.TrimSpace(part), ";")
+		name := strings.ToLower(strings.TrimSpace(fields[0]))
+
+		q := 1.0
+		for _, f := range fields[1:] {
+			f = strings.TrimSpace(f)
+			if strings.HasPrefix(f, "q=") {
+				if v, err := strconv.ParseFloat(f[2:], 64); err == nil {
+					q = v
+				}
+			}
+		}
+
+		if name == "*" {
+			name = encodingBrotli
+		}
+		if (name != encodingBrotli && name != encodingGzip) || q <= 0 {
+			continue
+		}
+
+		if q > bestQ || (q == bestQ && name == encodingBrotli) {
+			best, bestQ = name, q
+		}
+	}
+
+	return best
+}
+
+func (c *compressor) compressible(header http.Header) bool {
+	if len(header.Get("Content-Encoding")) > 0 {
+		return false
+	}
+
+	mediaType, _, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err != nil {
+		return false
+	}
+
+	return c.types[mediaType]
+}
+
+func (c *compressor) encoder(w io.Writer, encoding string) io.WriteCloser {
+	if encoding == encodingBrotli {
+		level := c.level
+		if level < brotli.BestSpeed || level > brotli.BestCompression {
+			level = brotli.DefaultCompression
+		}
+		return brotli.NewWriterLevel(w, level)
+	}
+
+	if gz, ok := c.gzipPool.Get().(*gzip.Writer); ok {
+		gz.Reset(w)
+		return &pooledGzip{Writer: gz, pool: &c.gzipPool}
+	}
+
+	gz, err := gzip.NewWriterLevel(w, c.level)
+	if err != nil {
+		gz = gzip.NewWriter(w)
+	}
+
+	return &pooledGzip{Writer: gz, pool: &c.gzipPool}
+}
+
+// pooledGzip put the gzip writer back into the pool on Close
+type pooledGzip struct {
+	*gzip.Writer
+	pool *sync.Pool
+}
+
+func (p *pooledGzip) Close() error {
+	err := p.Writer.Close()
+	p.pool.Put(p.Writer)
+
+	return err
+}
+
+// compressWriter buffer the first minSize bytes of the body to decide whether it is compressed
+type compressWriter struct {
+	http.ResponseWriter
+	c        *compressor
+	encoding string
+	// ifNoneMatch the If-None-Match of the request, to give a 304 the ETag the client has
+	ifNoneMatch string
+
+	status      int
+	wroteHeader bool
+	decided     bool
+	buf         bytes.Buffer
+	enc         io.WriteCloser
+}
+
+func (cw *compressWriter) WriteHeader(status int) {
+	if cw.wroteHeader {
+		return
+	}
+	cw.wroteHeader = true
+	cw.status = status
+
+	// a response without a body is not delayed
+	if status < http.StatusOK || status == http.StatusNoContent || status == http.StatusNotModified {
+		cw.decided = true
+		if status == http.StatusNotModified {
+			cw.notModifiedETag()
+		}
+		cw.ResponseWriter.WriteHeader(status)
+	}
+}
+
+func (cw *compressWriter) Write(p []byte) (int, error) {
+	if !cw.wroteHeader {
+		cw.WriteHeader(http.StatusOK)
+	}
+
+	if cw.decided {
+		if cw.enc != nil {
+			return cw.enc.Write(p)
+		}
+		return cw.ResponseWriter.Write(p)
+	}
+
+	cw.buf.Write(p)
+	if cw.buf.Len() >= cw.c.minSize {
+		if err := cw.decide(true); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(p), nil
+}
+
+// decide write the header and the buffered body, compressed when it is big enough
+func (cw *compressWriter) decide(bigEnough bool) error {
+	cw.decided = true
+
+	h := cw.Header()
+	if bigEnough && cw.c.compressible(h) {
+		h.Set("Content-Encoding", cw.encoding)
+		h.Del("Content-Length")
+		if etag := h.Get("ETag"); len(etag) > 0 {
+			h.Set("ETag", encodedETag(etag, cw.encoding))
+		}
+		cw.enc = cw.c.encoder(cw.ResponseWriter, cw.encoding)
+	}
+
+	cw.ResponseWriter.WriteHeader(cw.status)
+
+	if cw.buf.Len() == 0 {
+		return nil
+	}
+
+	var err error
+	if cw.enc != nil {
+		_, err = cw.enc.Write(cw.buf.Bytes())
+	} else {
+		_, err = cw.ResponseWriter.Write(cw.buf.Bytes())
+	}
+	cw.buf.Reset()
+
+	return err
+}
+
+// notModifiedETag give a 304 the encoded ETag when it is the one the client validated
+func (cw *compressWriter) notModifiedETag() {
+	etag := cw.Header().Get("ETag")
+	encoded := encodedETag(etag, cw.encoding)
+	if encoded == etag {
+		return
+	}
+
+	for _, candidate := range strings.Split(cw.ifNoneMatch, ",") {
+		if strings.TrimPrefix(strings.TrimSpace(candidate), "W/") == encoded {
+			cw.Header().Set("ETag", encoded)
+			return
+		}
+	}
+}
+
+// encodedETag the ETag of the compressed representation, which bytes differ from the identity one:
+// a strong ETag get the encoding as suffix, "abc" is "abc-gzip". A weak ETag is kept.
+func encodedETag(etag, encoding string) string {
+	if len(etag) < 2 || strings.HasPrefix(etag, "W/") || !strings.HasSuffix(etag, `"`) {
+		return etag
+	}
+
+	return etag[:len(etag)-1] + "-" + encoding + `"`
+}
+
+// decodedETag the ETag without the suffix of encodedETag
+func decodedETag(etag string) string {
+	for _, encoding := range []string{encodingGzip, encodingBrotli} {
+		if suffix := "-" + encoding + `"`; strings.HasSuffix(etag, suffix) {
+			return etag[:len(etag)-len(suffix)] + `"`
+		}
+	}
+
+	return etag
+}
+
+// Close write a response smaller than minSize as it is and finish the compressed stream
+func (cw *compressWriter) Close() error {
+	if !cw.wroteHeader {
+		return nil
+	}
+
+	if !cw.decided {
+		if err := cw.decide(false); err != nil {
+			return err
+		}
+	}
+
+	if cw.enc != nil {
+		return cw.enc.Close()
+	}
+
+	return nil
+}
+
+// Flush implement http.Flusher, the buffered body is sent as it is
+func (cw *compressWriter) Flush() {
+	if cw.wroteHeader && !cw.decided {
+		_ = cw.decide(cw.buf.Len() >= cw.c.minSize)
+	}
+
+	if f, ok := cw.enc.(interface{ Flush() error }); ok {
+		_ = f.Flush()
+	}
+
+	if f, ok := cw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack implement http.Hijacker
+func (cw *compressWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if h, ok := cw.ResponseWriter.(http.Hijacker); ok {
+		return h.Hijack()
+	}
+
+	return nil, nil, http.ErrNotSupported
+}
@@ -0,0 +1,196 @@
+package bootstrap
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// MsgPreconditionFailed the resource was changed since the version the client has
+const MsgPreconditionFailed = "ERR:PRECONDITION_FAILED"
+
+// ResourceVersion the version of a resource, given by the handler to the response helpers
+type ResourceVersion struct {
+	// ETag the entity tag, quoted by SetVersion when it is not
+	ETag string
+	// LastModified the last update of the resource
+	LastModified time.Time
+}
+
+// VersionOf build the version of a resource from its identity and last update,
+// e.g. VersionOf(user.UpdatedDate, user.ID)
+func VersionOf(updatedAt time.Time, parts ...interface{}) ResourceVersion {
+	h := sha256.New()
+	fmt.Fprint(h, updatedAt.UnixNano())
+	for _, p := range parts {
+		fmt.Fprintf(h, "|%v", p)
+	}
+
+	return ResourceVersion{
+		ETag:         `"` + hex.EncodeToString(h.Sum(nil)[:16]) + `"`,
+		LastModified: updatedAt,
+	}
+}
+
+// SetVersion set the ETag and Last-Modified headers of the response,
+// RespondWithJSON does not compute the ETag of the payload when it is set.
+func (h *App) SetVersion(w http.ResponseWriter, v ResourceVersion) {
+	if len(v.ETag) > 0 {
+		w.Header().Set("ETag", quoteETag(v.ETag))
+	}
+
+	if !v.LastModified.IsZero() {
+		w.Header().Set("Last-Modified", v.LastModified.UTC().Format(http.TimeFormat))
+	}
+}
+
+// CheckPrecondition check the If-Match and If-Unmodified-Since headers of an update
+// against the current version of the resource. It send 412 and return false on a conflict.
+func (h *App) CheckPrecondition(w http.ResponseWriter, r *http.Request, current ResourceVersion) bool {
+	if ifMatch := r.Header.Get("If-Match"); len(ifMatch) > 0 {
+		if !matchETag(ifMatch, quoteETag(current.ETag), false) {
+			h.RespondWithJSONR(w, r, http.StatusPreconditionFailed, MsgPreconditionFailed, "the resource was changed, reload it and try again", h.EmptyJSONArr(), h.EmptyJSONArr())
+			return false
+		}
+		return true
+	}
+
+	if since, err := http.ParseTime(r.Header.Get("If-Unmodified-Since")); err == nil && !current.LastModified.IsZero() {
+		if current.LastModified.Truncate(time.Second).After(since) {
+			h.RespondWithJSONR(w, r, http.StatusPreconditionFailed, MsgPreconditionFailed, "the resource was changed, reload it and try again", h.EmptyJSONArr(), h.EmptyJSONArr())
+			return false
+		}
+	}
+
+	return true
+}
+
+// ConditionalMiddleware answer 304 to a GET or HEAD when the response is not modified
+// since the version of the client, given by If-None-Match or If-Modified-Since.
+// The response version is the ETag and Last-Modified headers set by the handler or RespondWithJSON.
+func (app *App) ConditionalMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if (r.Method != http.MethodGet && r.Method != http.MethodHead) ||
+			(len(r.Header.Get("If-None-Match")) == 0 && len(r.Header.Get("If-Modified-Since")) == 0) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		next.ServeHTTP(&conditionalWriter{ResponseWriter: w, r: r}, r)
+	})
+}
+
+// conditionalWriter replace a 200 response with 304 when the client has the same version
+type conditionalWriter struct {
+	http.ResponseWriter
+	r           *http.Request
+	wroteHeader bool
+	notModified bool
+}
+
+func (c *conditionalWriter) WriteHeader(status int) {
+	if c.wroteHeader {
+		return
+	}
+	c.wroteHeader = true
+
+	if status == http.StatusOK && notModified(c.r, c.Header()) {
+		c.notModified = true
+		for _, k := range []string{"Content-Type", "Content-Length"} {
+			c.Header().Del(k)
+		}
+		c.ResponseWriter.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	c.ResponseWriter.WriteHeader(status)
+}
+
+func (c *conditionalWriter) Write(p []byte) (int, error) {
+	if !c.wroteHeader {
+		c.WriteHeader(http.StatusOK)
+	}
+
+	if c.notModified {
+		return len(p), nil
+	}
+
+	return c.ResponseWriter.Write(p)
+}
+
+// Flush implement http.Flusher
+func (c *conditionalWriter) Flush() {
+	if !c.wroteHeader {
+		c.WriteHeader(http.StatusOK)
+	}
+
+	if f, ok := c.ResponseWriter.(http.Flusher); ok && !c.notModified {
+		f.Flush()
+	}
+}
+
+// notModified compare the request validators with the response ones,
+// If-Modified-Since is ignored when If-None-Match is given (RFC 7232 section 6)
+func notModified(r *http.Request, header http.Header) bool {
+	if inm := r.Header.Get("If-None-Match"); len(inm) > 0 {
+		etag := header.Get("ETag")
+		return len(etag) > 0 && matchETag(inm, etag, true)
+	}
+
+	since, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	if err != nil {
+		return false
+	}
+
+	modified, err := http.ParseTime(header.Get("Last-Modified"))
+	if err != nil {
+		return false
+	}
+
+	return !modified.After(since)
+}
+
+// matchETag match the etag against the list of a If-Match/If-None-Match header,
+// the weak comparison ignore the W/ prefix. The encoding suffix of CompressMiddleware is ignored.
+func matchETag(list, etag string, weak bool) bool {
+	if strings.TrimSpace(list) == "*" {
+		return len(etag) > 0
+	}
+
+	if weak {
+		etag = strings.TrimPrefix(etag, "W/")
+	} else if strings.HasPrefix(etag, "W/") {
+		return false
+	}
+
+	for _, candidate := range strings.Split(list, ",") {
+		candidate = decodedETag(strings.TrimSpace(candidate))
+		if weak {
+			candidate = strings.TrimPrefix(candidate, "W/")
+		}
+
+		if candidate == etag {
+			return true
+		}
+	}
+
+	return false
+}
+
+// quoteETag quote the etag when the handler gave a bare version
+func quoteETag(etag string) string {
+	if len(etag) == 0 || strings.HasPrefix(etag, `"`) || strings.HasPrefix(etag, `W/"`) {
+		return etag
+	}
+
+	return `"` + etag + `"`
+}
+
+// bodyETag the strong validator of a body
+func bodyETag(body []byte) string {
+	sum := sha256.Sum256(body)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
@@ -0,0 +1,183 @@
+package bootstrap
+
+import (
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/cors"
+)
+
+// corsChannels the channels that can have their own CORS policy under `cors.channels.<channel>`
+var corsChannels = []string{HTTPCmsChannel, HTTPTravellerChannel}
+
+// dflCorsOptions the policy used for the values missing from the `cors` config
+var dflCorsOptions = cors.Options{
+	AllowedOrigins: []string{"*"},
+	AllowedMethods: []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
+	AllowedHeaders: []string{
+		"Accept",
+		"Authorization",
+		"Content-Type",
+		"Content-Encoding",
+		"X-CSRF-Token",
+		XSignature,
+		XTimestamp,
+		XClientID,
+		XNonce,
+		XChannelHeader,
+		IdempotencyKeyHeader,
+		"If-Match",
+		"If-None-Match",
+		"If-Modified-Since",
+		"If-Unmodified-Since",
+	},
+	ExposedHeaders: []string{"Link", "ETag", "Last-Modified", IdempotentReplayedHeader, XIncidentID},
+	MaxAge:         300,
+}
+
+// corsPolicy a CORS handler with the origin patterns it was built from
+type corsPolicy struct {
+	cors    *cors.Cors
+	origins []string
+}
+
+// CorsMiddleware apply the CORS policy of the request channel.
+//
+// The default policy is read from `cors` (allowed_origins, allowed_methods, allowed_headers,
+// exposed_headers, allow_credentials, max_age), each channel of `cors.channels.<channel>`
+// override the values it sets. Origins may use one wildcard, e.g. "https://*.hypefast.id".
+// The policy is chosen by the X-CHANNEL header, a preflight request does not carry it
+// so the policy whose origins match the Origin header is used instead.
+func (app *App) CorsMiddleware() func(http.Handler) http.Handler {
+	base := app.corsOptions("cors", dflCorsOptions)
+	dfl := newCorsPolicy(base)
+
+	policies := map[string]*corsPolicy{}
+	var ordered []*corsPolicy
+	for _, channel := range corsChannels {
+		key := "cors.channels." + channel
+		if len(app.Config.GetStringMapString(key)) == 0 {
+			continue
+		}
+
+		p := newCorsPolicy(app.corsOptions(key, base))
+		policies[channel] = p
+		ordered = append(ordered, p)
+	}
+
+	return func(next http.Handler) http.Handler {
+		handlers := map[*corsPolicy]http.Handler{dfl: dfl.cors.Handler(next)}
+		for _, p := range ordered {
+			handlers[p] = p.cors.Handler(next)
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			p := dfl
+			if len(policies) > 0 {
+				w.Header().Add("Vary", XChannelHeader)
+				p = selectCorsPolicy(r, dfl, policies, ordered)
+			}
+
+			handlers[p].ServeHTTP(w, r)
+		})
+	}
+}
+
+// selectCorsPolicy the policy of the X-CHANNEL header (case insensitive), or for a preflight
+// the first channel which explicitly allow the origin, fallback into the default policy.
+func selectCorsPolicy(r *http.Request, dfl *corsPolicy, policies map[string]*corsPolicy, ordered []*corsPolicy) *corsPolicy {
+	if p, ok := policies[strings.ToLower(strings.TrimSpace(r.Header.Get(XChannelHeader)))]; ok {
+		return p
+	}
+
+	origin := r.Header.Get("Origin")
+	if r.Method != http.MethodOptions || len(origin) == 0 || len(r.Header.Get("Access-Control-Request-Method")) == 0 {
+		return dfl
+	}
+
+	for _, p := range ordered {
+		if p.allowOrigin(origin) {
+			return p
+		}
+	}
+
+	return dfl
+}
+
+// corsOptions read the CORS options of the config key, the missing values are taken from base.
+// Credentials are refused together with the "*" origin since browsers reject that response.
+func (app *App) corsOptions(key string, base cors.Options) cors.Options {
+	opts := base
+
+	if v := app.Config.GetStringSlice(key + ".allowed_origins"); len(v) > 0 {
+		opts.AllowedOrigins = v
+	}
+	if v := app.Config.GetStringSlice(key + ".allowed_methods"); len(v) > 0 {
+		opts.AllowedMethods = v
+	}
+	if v := app.Config.GetStringSlice(key + ".allowed_headers"); len(v) > 0 {
+		opts.AllowedHeaders = v
+	}
+	if v := app.Config.GetStringSlice(key + ".exposed_headers"); len(v) > 0 {
+		opts.ExposedHeaders = v
+	}
+	if app.Config.GetString(key+".allow_credentials") != "" {
+		opts.AllowCredentials = app.Config.GetBool(key + ".allow_credentials")
+	}
+	if app.Config.GetString(key+".max_age") != "" {
+		opts.MaxAge = app.Config.GetInt(key + ".max_age")
+	}
+
+	if opts.AllowCredentials && containsString(opts.AllowedOrigins, "*") {
+		log.Printf("[cors] %s: allow_credentials is ignored with the \"*\" origin, list the allowed origins instead", key)
+		opts.AllowCredentials = false
+	}
+
+	return opts
+}
+
+func newCorsPolicy(opts cors.Options) *corsPolicy {
+	origins := make([]string, 0, len(opts.AllowedOrigins))
+	for _, o := range opts.AllowedOrigins {
+		origins = append(origins, strings.ToLower(o))
+	}
+
+	return &corsPolicy{cors: cors.New(opts), origins: origins}
+}
+
+// allowOrigin is the origin explicitly listed by the policy, the "*" origin is not taken into account
+func (p *corsPolicy) allowOrigin(origin string) bool {
+	origin = strings.ToLower(origin)
+	for _, pattern := range p.origins {
+		if pattern != "*" && matchOrigin(pattern, origin) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// matchOrigin match the origin with a pattern that has at most one wildcard
+func matchOrigin(pattern, origin string) bool {
+	i := strings.IndexByte(pattern, '*')
+	if i < 0 {
+		return pattern == origin
+	}
+
+	prefix, suffix := pattern[:i], pattern[i+1:]
+
+	return len(origin) >= len(prefix)+len(suffix) &&
+		strings.HasPrefix(origin, prefix) &&
+		strings.HasSuffix(origin, suffix)
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,229 @@
+package bootstrap
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"hypefast-api/lib/utils"
+)
+
+const corsConfig = `{
+  "cors": {
+    "allowed_origins": ["*"],
+    "max_age": 300,
+    "channels": {
+      "webcms": {
+        "allowed_origins": ["https://cms.hypefast.id"],
+        "allow_credentials": true
+      },
+      "webtraveller": {
+        "allowed_origins": ["https://*.hypefast.id"],
+        "allow_credentials": true,
+        "max_age": 600
+      }
+    }
+  }
+}`
+
+// newConfigApp an app with the config of the json document
+func newConfigApp(t *testing.T, config string) *App {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := ioutil.WriteFile(path, []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	return &App{Config: utils.NewViperConfig("", path)}
+}
+
+func TestCorsMiddleware(t *testing.T) {
+	app := newConfigApp(t, corsConfig)
+	handler := app.CorsMiddleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	tests := []struct {
+		name    string
+		method  string
+		origin  string
+		channel string
+		// reqHeaders the Access-Control-Request-Headers of a preflight
+		reqHeaders string
+		// want the expected Access-Control-* headers, an empty value is an absent header
+		want map[string]string
+	}{
+		{
+			name:   "preflight of the webcms origin",
+			method: http.MethodOptions,
+			origin: "https://cms.hypefast.id",
+			want: map[string]string{
+				"Access-Control-Allow-Origin":      "https://cms.hypefast.id",
+				"Access-Control-Allow-Credentials": "true",
+				"Access-Control-Allow-Methods":     "POST",
+				"Access-Control-Max-Age":           "300",
+			},
+		},
+		{
+			name:   "preflight of a webtraveller wildcard subdomain",
+			method: http.MethodOptions,
+			origin: "https://shop.hypefast.id",
+			want: map[string]string{
+				"Access-Control-Allow-Origin":      "https://shop.hypefast.id",
+				"Access-Control-Allow-Credentials": "true",
+				"Access-Control-Max-Age":           "600",
+			},
+		},
+		{
+			name:       "preflight with an allowed request header",
+			method:     http.MethodOptions,
+			origin:     "https://cms.hypefast.id",
+			reqHeaders: "X-Channel",
+			want: map[string]string{
+				"Access-Control-Allow-Origin":  "https://cms.hypefast.id",
+				"Access-Control-Allow-Headers": "X-Channel",
+			},
+		},
+		{
+			name:       "preflight with a disallowed request header",
+			method:     http.MethodOptions,
+			origin:     "https://cms.hypefast.id",
+			reqHeaders: "X-Unknown",
+			want: map[string]string{
+				"Access-Control-Allow-Origin":      "",
+				"Access-Control-Allow-Credentials": "",
+			},
+		},
+		{
+			name:   "preflight of an unlisted origin get the default policy",
+			method: http.MethodOptions,
+			origin: "https://evil.com",
+			want: map[string]string{
+				"Access-Control-Allow-Origin":      "*",
+				"Access-Control-Allow-Credentials": "",
+				"Access-Control-Max-Age":           "300",
+			},
+		},
+		{
+			name:   "preflight of a look-alike of the wildcard",
+			method: http.MethodOptions,
+			origin: "https://hypefast.id.evil.com",
+			want: map[string]string{
+				"Access-Control-Allow-Origin":      "*",
+				"Access-Control-Allow-Credentials": "",
+			},
+		},
+		{
+			name:    "webcms request from its origin",
+			method:  http.MethodGet,
+			origin:  "https://cms.hypefast.id",
+			channel: HTTPCmsChannel,
+			want: map[string]string{
+				"Access-Control-Allow-Origin":      "https://cms.hypefast.id",
+				"Access-Control-Allow-Credentials": "true",
+				"Access-Control-Expose-Headers":    "Link, Etag, Last-Modified, Idempotent-Replayed, X-Incident-Id",
+			},
+		},
+		{
+			name:    "webcms request with an uppercase channel",
+			method:  http.MethodGet,
+			origin:  "https://cms.hypefast.id",
+			channel: "WEBCMS",
+			want: map[string]string{
+				"Access-Control-Allow-Origin":      "https://cms.hypefast.id",
+				"Access-Control-Allow-Credentials": "true",
+			},
+		},
+		{
+			name:    "webcms request from a disallowed origin",
+			method:  http.MethodGet,
+			origin:  "https://evil.com",
+			channel: HTTPCmsChannel,
+			want: map[string]string{
+				"Access-Control-Allow-Origin":      "",
+				"Access-Control-Allow-Credentials": "",
+			},
+		},
+		{
+			name:    "webtraveller request from a wildcard subdomain",
+			method:  http.MethodGet,
+			origin:  "https://shop.hypefast.id",
+			channel: HTTPTravellerChannel,
+			want: map[string]string{
+				"Access-Control-Allow-Origin":      "https://shop.hypefast.id",
+				"Access-Control-Allow-Credentials": "true",
+			},
+		},
+		{
+			name:    "webtraveller request from another domain",
+			method:  http.MethodGet,
+			origin:  "https://cms.hypefast.com",
+			channel: HTTPTravellerChannel,
+			want: map[string]string{
+				"Access-Control-Allow-Origin": "",
+			},
+		},
+		{
+			name:   "request without channel get the default policy",
+			method: http.MethodGet,
+			origin: "https://evil.com",
+			want: map[string]string{
+				"Access-Control-Allow-Origin":      "*",
+				"Access-Control-Allow-Credentials": "",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, "/v1/api/", nil)
+			r.Header.Set("Origin", tt.origin)
+			if len(tt.channel) > 0 {
+				r.Header.Set(XChannelHeader, tt.channel)
+			}
+			if tt.method == http.MethodOptions {
+				r.Header.Set("Access-Control-Request-Method", http.MethodPost)
+				if len(tt.reqHeaders) > 0 {
+					r.Header.Set("Access-Control-Request-Headers", tt.reqHeaders)
+				}
+			}
+
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+
+			for header, want := range tt.want {
+				if got := w.Header().Get(header); got != want {
+					t.Errorf("%s = %q, want %q", header, got, want)
+				}
+			}
+
+			vary := strings.Join(w.Header().Values("Vary"), ", ")
+			if !strings.Contains(vary, XChannelHeader) || !strings.Contains(vary, "Origin") {
+				t.Errorf("Vary = %q, want X-CHANNEL and Origin", vary)
+			}
+		})
+	}
+}
+
+func TestCorsMiddlewareCredentialsWithAnyOrigin(t *testing.T) {
+	app := newConfigApp(t, `{"cors": {"allowed_origins": ["*"], "allow_credentials": true}}`)
+	handler := app.CorsMiddleware()(http.NotFoundHandler())
+
+	r := httptest.NewRequest(http.MethodOptions, "/v1/api/", nil)
+	r.Header.Set("Origin", "https://evil.com")
+	r.Header.Set("Access-Control-Request-Method", http.MethodGet)
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+
+	if got := w.Header().Get("Access-Control-Allow-Origin"); got != "*" {
+		t.Errorf("Access-Control-Allow-Origin = %q, want *", got)
+	}
+	if got := w.Header().Get("Access-Control-Allow-Credentials"); got != "" {
+		t.Errorf("Access-Control-Allow-Credentials = %q, want none", got)
+	}
+}
@@ -0,0 +1,63 @@
+package bootstrap
+
+import (
+	"errors"
+	"net/http"
+
+	"hypefast-api/lib/apperr"
+
+	"github.com/jackc/pgconn"
+	"github.com/sirupsen/logrus"
+)
+
+// errorData the data of an error response
+type errorData struct {
+	Code       string      `json:"code,omitempty"`
+	Details    interface{} `json:"details,omitempty"`
+	IncidentID string      `json:"incident_id,omitempty"`
+}
+
+// SendError send any error with the status and stat code of its apperr.Error, see apperr.From
+// for the mapping of the storage errors. The cause is logged but never sent to the client:
+// a 5xx is logged as an error with an incident id given in the response and the X-Incident-Id header,
+// a 4xx with a cause as a warning.
+func (h *App) SendError(w http.ResponseWriter, r *http.Request, err error) {
+	e := apperr.From(err)
+	if e == nil {
+		e = apperr.Internal(nil)
+	}
+
+	data := errorData{Code: e.Code, Details: e.Details}
+
+	fields := logrus.Fields{
+		"code":      e.Code,
+		"stat_code": e.StatCode,
+		"status":    e.Status,
+		"method":    r.Method,
+		"path":      r.URL.Path,
+	}
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		fields["constraint"] = pgErr.ConstraintName
+		fields["column"] = pgErr.ColumnName
+	}
+	entry := h.Log.FromDefault().WithContext(r.Context())
+
+	switch {
+	case e.Status >= http.StatusInternalServerError:
+		data.IncidentID = newIncidentID()
+		fields["event_id"] = data.IncidentID
+		fields["incident_id"] = data.IncidentID
+		w.Header().Set(XIncidentID, data.IncidentID)
+		entry.WithFields(fields).Errorf("%s %s: %v", r.Method, r.URL.Path, err)
+	case e.Cause != nil:
+		entry.WithFields(fields).Warnf("%s %s: %v", r.Method, r.URL.Path, err)
+	}
+
+	message, ok := h.I18n.Lookup(h.Locale(r), e.MessageKey)
+	if !ok {
+		message = e.Message
+	}
+
+	h.RespondWithJSONR(w, r, e.Status, e.StatCode, message, data, h.EmptyJSONArr())
+}
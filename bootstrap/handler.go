@@ -9,7 +9,8 @@ import (
 	"strconv"
 	"strings"
 
-	"hypefast-api/lib/utils"
+	"hypefast-api/lib/psql"
+	"hypefast-api/lib/tracing"
 
 	validator "github.com/go-playground/validator/v10"
 )
@@ -39,6 +40,12 @@ const (
 	// MsgBadReq for general bad request
 	MsgBadReq = "ERR:BAD_REQUEST"
 
+	// MsgInternal for unexpected server error 500
+	MsgInternal = "ERR:INTERNAL"
+
+	// XIncidentID the id of the incident of a 500 response, to be given to the administrator
+	XIncidentID = "X-Incident-Id"
+
 	// MsgNotfound for not found 404 page
 	MsgNotfound = "ERR:NOT_FOUND"
 
@@ -68,14 +75,18 @@ func (h *App) ErrorBase64() error {
 }
 
 // Bind bind the API request payload (body) into request struct.
+// The error is ErrBodyTooLarge when the body is over the limit, send it with SendBindError.
+// Use BindAndValidate to decode the query and forms too, refuse the unknown fields and validate.
 func (h *App) Bind(r *http.Request, input interface{}) error {
-	err := json.NewDecoder(r.Body).Decode(&input)
-
-	return err
+	return json.NewDecoder(r.Body).Decode(input)
 }
 
-// GetChannel ...
+// GetChannel the channel resolved by HeaderCheckerMiddleware, fallback into the X-CHANNEL header
 func (h *App) GetChannel(r *http.Request) string {
+	if channel, ok := r.Context().Value(channelCtxKey).(string); ok {
+		return channel
+	}
+
 	return r.Header.Get(XChannelHeader)
 }
 
@@ -90,56 +101,109 @@ func (h *App) EmptyJSONArr() []map[string]interface{} {
 }
 
 // SendSuccess send success into response with 200 http code.
+//
+// Deprecated: use SendSuccessR, which answer in the language of the request.
 func (h *App) SendSuccess(w http.ResponseWriter, payload interface{}, pagination interface{}) {
+	h.SendSuccessR(w, nil, payload, pagination)
+}
+
+// SendSuccessR send success into response with 200 http code.
+func (h *App) SendSuccessR(w http.ResponseWriter, r *http.Request, payload interface{}, pagination interface{}) {
 	if pagination == nil {
 		pagination = h.EmptyJSONArr()
 	}
-	h.RespondWithJSON(w, 200, MsgSuccess, "Success", payload, pagination)
+	h.RespondWithJSONR(w, r, 200, MsgSuccess, "Success", payload, pagination)
 }
 
 // SendBadRequest send bad request into response with 400 http code.
+//
+// Deprecated: use SendBadRequestR, which answer in the language of the request.
 func (h *App) SendBadRequest(w http.ResponseWriter, message string) {
-	h.RespondWithJSON(w, 400, MsgBadReq, message, h.EmptyJSONArr(), h.EmptyJSONArr())
+	h.SendBadRequestR(w, nil, message)
+}
+
+// SendBadRequestR send bad request into response with 400 http code.
+func (h *App) SendBadRequestR(w http.ResponseWriter, r *http.Request, message string) {
+	h.RespondWithJSONR(w, r, 400, MsgBadReq, message, h.EmptyJSONArr(), h.EmptyJSONArr())
 }
 
 // SendBadWithNilDataRequest send bad request into response with 400 http code.
+//
+// Deprecated: use SendBadWithNilDataRequestR, which answer in the language of the request.
 func (h *App) SendBadWithNilDataRequest(w http.ResponseWriter, message string) {
-	h.RespondWithJSON(w, 400, MsgBadReq, message, nil, h.EmptyJSONArr())
+	h.SendBadWithNilDataRequestR(w, nil, message)
+}
+
+// SendBadWithNilDataRequestR send bad request into response with 400 http code.
+func (h *App) SendBadWithNilDataRequestR(w http.ResponseWriter, r *http.Request, message string) {
+	h.RespondWithJSONR(w, r, 400, MsgBadReq, message, nil, h.EmptyJSONArr())
 }
 
 // SendNotfound send bad request into response with 400 http code.
+//
+// Deprecated: use SendNotfoundR, which answer in the language of the request.
 func (h *App) SendNotfound(w http.ResponseWriter, message string) {
-	h.RespondWithJSON(w, 404, MsgNotfound, message, h.EmptyJSONArr(), h.EmptyJSONArr())
+	h.SendNotfoundR(w, nil, message)
+}
+
+// SendNotfoundR send not found into response with 404 http code.
+func (h *App) SendNotfoundR(w http.ResponseWriter, r *http.Request, message string) {
+	h.RespondWithJSONR(w, r, 404, MsgNotfound, message, h.EmptyJSONArr(), h.EmptyJSONArr())
 }
 
 // SendAuthError send bad request into response with 400 http code.
+//
+// Deprecated: use SendAuthErrorR, which answer in the language of the request.
 func (h *App) SendAuthError(w http.ResponseWriter, message string) {
-	h.RespondWithJSON(w, 401, MsgAuthErr, message, h.EmptyJSONArr(), h.EmptyJSONArr())
+	h.SendAuthErrorR(w, nil, message)
+}
+
+// SendAuthErrorR send auth error into response with 401 http code.
+func (h *App) SendAuthErrorR(w http.ResponseWriter, r *http.Request, message string) {
+	h.RespondWithJSONR(w, r, 401, MsgAuthErr, message, h.EmptyJSONArr(), h.EmptyJSONArr())
 }
 
 // SendUnAuthorizedData send bad request into response with 400 http code.
+//
+// Deprecated: use SendUnAuthorizedDataR, which answer in the language of the request.
 func (h *App) SendUnAuthorizedData(w http.ResponseWriter) {
-	h.RespondWithJSON(w, 401, MsgAuthorizedErr, "unauthorized data", h.EmptyJSONArr(), h.EmptyJSONArr())
+	h.SendUnAuthorizedDataR(w, nil)
+}
+
+// SendUnAuthorizedDataR send unauthorized data into response with 401 http code.
+func (h *App) SendUnAuthorizedDataR(w http.ResponseWriter, r *http.Request) {
+	h.RespondWithJSONR(w, r, 401, MsgAuthorizedErr, "unauthorized data", h.EmptyJSONArr(), h.EmptyJSONArr())
 }
 
 // SendRequestValidationError Send validation error response to consumers.
+//
+// Deprecated: use SendRequestValidationErrorR, which answer in the language of the request.
 func (h *App) SendRequestValidationError(w http.ResponseWriter, validationErrors validator.ValidationErrors) {
+	h.SendRequestValidationErrorR(w, nil, validationErrors)
+}
+
+// SendRequestValidationErrorR Send validation error response to consumers.
+// The errors are keyed by the JSON path of the field, e.g. items[0].sku.
+func (h *App) SendRequestValidationErrorR(w http.ResponseWriter, r *http.Request, validationErrors validator.ValidationErrors) {
 	errorResponse := map[string][]string{}
-	errorTranslation := validationErrors.Translate(h.Validator.Translator)
-	// fmt.Println(errorTranslation)
-	// fmt.Println(validationErrors)
+	errorTranslation := validationErrors.Translate(h.Validator.TranslatorFor(h.Locale(r)))
 	for _, err := range validationErrors {
-		errKey := utils.Underscore(err.StructField())
-		errorResponse[errKey] = append(
-			errorResponse[errKey],
-			strings.Replace(errorTranslation[err.Namespace()], err.StructField(), "[]", -1),
-		)
+		errKey := fieldPath(err)
+		message := errorTranslation[err.Namespace()]
+		if strings.Contains(message, err.Field()) {
+			message = strings.Replace(message, err.Field(), "[]", 1)
+		} else {
+			message = strings.Replace(message, err.StructField(), "[]", 1)
+		}
+		errorResponse[errKey] = append(errorResponse[errKey], message)
 	}
 
-	h.RespondWithJSON(w, 400, MsgErrValidation, "validation error", errorResponse, h.EmptyJSONArr())
+	h.RespondWithJSONR(w, r, 400, MsgErrValidation, "validation error", errorResponse, h.EmptyJSONArr())
 }
 
-// RespondWithJSON write json response format
+// RespondWithJSON write json response format.
+//
+// Deprecated: use RespondWithJSONR, which answer in the language of the request.
 func (h *App) RespondWithJSON(
 	w http.ResponseWriter,
 	httpCode int,
@@ -148,20 +212,72 @@ func (h *App) RespondWithJSON(
 	payload interface{},
 	pagination interface{},
 ) {
-	respPayload := map[string]interface{}{
-		"stat_code":  statCode,
-		"stat_msg":   message,
-		"pagination": pagination,
-		"data":       payload,
+	h.RespondWithJSONR(w, nil, httpCode, statCode, message, payload, pagination)
+}
+
+// RespondWithJSONR write json response format,
+// the message is translated into the language of the request when the catalog knows it.
+// Without a request (the deprecated helpers) it is translated into the default language.
+// An error is sent as a RFC 7807 problem document on the routes of ProblemMiddleware
+// and to the clients selected by NegotiateProblemMiddleware.
+func (h *App) RespondWithJSONR(
+	w http.ResponseWriter,
+	r *http.Request,
+	httpCode int,
+	statCode string,
+	message string,
+	payload interface{},
+	pagination interface{},
+) {
+	if httpCode >= http.StatusBadRequest && wantsProblem(r) {
+		h.respondWithProblem(w, r, httpCode, statCode, message, payload)
+		return
 	}
 
-	response, _ := json.Marshal(respPayload)
+	env := h.envelope(w, r, statCode, message, payload, pagination)
+	traceID, _ := env["trace_id"].(string)
+	delete(env, "trace_id")
+	response, _ := json.Marshal(env)
+
+	// the trace id is not part of the version, the etag is the hash of the body without it
+	if httpCode == http.StatusOK && len(w.Header().Get("ETag")) == 0 {
+		w.Header().Set("ETag", bodyETag(response))
+	}
+	if len(traceID) > 0 {
+		response = appendTraceID(response, traceID)
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(httpCode)
 	_, _ = w.Write(response)
 }
 
+// envelope the body of the responses, the trace id is the one of the response header
+func (h *App) envelope(w http.ResponseWriter, r *http.Request, statCode, message string, payload, pagination interface{}) map[string]interface{} {
+	env := map[string]interface{}{
+		"stat_code":  statCode,
+		"stat_msg":   h.translateMessage(r, message),
+		"pagination": pagination,
+		"data":       payload,
+	}
+	if traceID := w.Header().Get(tracing.TraceIDHeader); len(traceID) > 0 {
+		env["trace_id"] = traceID
+	}
+
+	return env
+}
+
+// appendTraceID add the trace_id member at the end of the marshalled envelope,
+// where json.Marshal would put it since the keys of a map are sorted
+func appendTraceID(body []byte, traceID string) []byte {
+	id, _ := json.Marshal(traceID)
+
+	body = append(body[:len(body)-1], `,"trace_id":`...)
+	body = append(body, id...)
+
+	return append(body, '}')
+}
+
 // GetUserID ...
 func (h *App) GetUserID(ctx context.Context) (int64, error) {
 	usX := fmt.Sprintf("%v", ctx.Value("user_id"))
@@ -194,7 +310,9 @@ type ParamOrder struct {
 	By    string
 }
 
-// GetParamOrder Parse the url param to get order field & order by value
+// GetParamOrder Parse the url param to get order field & order by value.
+//
+// Deprecated: the field is not checked against a whitelist, use GetListQuery.
 func (h *App) GetParamOrder(r *http.Request) (ParamOrder, error) {
 	param := strings.Split(r.URL.Query().Get("order"), ",")
 	pOrder := ParamOrder{}
@@ -208,6 +326,21 @@ func (h *App) GetParamOrder(r *http.Request) (ParamOrder, error) {
 	return pOrder, nil
 }
 
+// GetListQuery parse the sort and filter params against the whitelist of the resource (see psql.ParseListQuery),
+// a field or operator out of the whitelist give an ERR:INVALID_PARAM error to send with SendError.
+func (h *App) GetListQuery(r *http.Request, resource psql.Resource) (psql.ListQuery, error) {
+	q, err := psql.ParseListQuery(r.URL.Query(), resource)
+	if err != nil {
+		var pe *psql.ParamError
+		if errors.As(err, &pe) {
+			return q, invalidParam(pe.Param, pe.Message)
+		}
+		return q, err
+	}
+
+	return q, nil
+}
+
 // GetIntParam Parse the url param to get value as integer.
 // for example, we need to get limit and offset param
 func (h *App) GetIntParam(r *http.Request, name string) (int, error) {
@@ -245,40 +378,5 @@ func (h *App) GetBoolParam(r *http.Request, name string) (bool, error) {
 }
 
 func (h *App) PingAction(w http.ResponseWriter, r *http.Request) {
-	h.SendSuccess(w, h.EmptyJSONArr(), nil)
-}
-
-// func generateSig(s reflect.Value, timestamp string) string {
-// 	typeOfT := s.Type()
-// 	combine := ""
-// 	for i := 0; i < s.NumField(); i++ {
-// 		f := s.Field(i)
-// 		value := fmt.Sprintf("%v", f.Interface())
-// 		vb := []byte(value)
-// 		bs := sha1.Sum(vb)
-// 		hVal := hex.EncodeToString(bs[:])
-
-// 		combine += fmt.Sprintf("%s%s", typeOfT.Field(i).Tag.Get("json"), hVal)
-// 	}
-// 	// create complete sha1
-// 	bSum := sha1.Sum([]byte(combine + timestamp))
-// 	bSumVal := hex.EncodeToString(bSum[:])
-
-// 	return bSumVal
-// }
-
-// // isValidSignature ...
-// func isValidSignature(obj reflect.Value, timestamp, comparator string) bool {
-// 	return generateSig(obj, timestamp) == comparator
-// }
-
-// // isValidSettingSignature ...
-// func isValidSettingSignature(r *http.Request, key string) bool {
-// 	sig := r.Header.Get(XSignature)
-// 	ts := r.Header.Get(XTimestamp)
-
-// 	bSum := sha1.Sum([]byte(key + ts))
-// 	bSumVal := hex.EncodeToString(bSum[:])
-
-// 	return sig == bSumVal
-// }
+	h.SendSuccessR(w, r, h.EmptyJSONArr(), nil)
+}
@@ -0,0 +1,164 @@
+package bootstrap
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// channelCtxKey context key of the channel resolved by HeaderCheckerMiddleware
+const channelCtxKey = "channel"
+
+// HeaderRule the accepted values of a request header.
+// A value is accepted when it equals one of Values (ignoring the parameters after ";")
+// or starts with one of Prefixes, the comparison is case insensitive.
+// The header is required for Methods (every method when empty),
+// on the other methods it is only checked when it is sent.
+type HeaderRule struct {
+	Header   string
+	Values   []string
+	Prefixes []string
+	Methods  []string
+}
+
+// dflHeaderRules the rules used when `header_policy` is not configured
+var dflHeaderRules = []HeaderRule{
+	{
+		Header: XChannelHeader,
+		Values: []string{HTTPTravellerChannel, HTTPCmsChannel},
+	},
+	{
+		Header:   "Content-Type",
+		Prefixes: []string{"application/json"},
+		Methods:  []string{http.MethodPost, http.MethodPut, http.MethodPatch},
+	},
+}
+
+// headerRules read the rules from the `header_policy` config, one entry per header:
+//
+//	"header_policy": {
+//	  "X-CHANNEL": {"values": ["webtraveller", "webcms"]},
+//	  "Content-Type": {"prefixes": ["application/json"], "methods": ["POST", "PUT", "PATCH"]}
+//	}
+func (app *App) headerRules() []HeaderRule {
+	headers := app.Config.GetStringMapString("header_policy")
+	if len(headers) == 0 {
+		return dflHeaderRules
+	}
+
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	rules := make([]HeaderRule, 0, len(names))
+	for _, name := range names {
+		key := "header_policy." + name
+		rules = append(rules, HeaderRule{
+			Header:   http.CanonicalHeaderKey(name),
+			Values:   app.Config.GetStringSlice(key + ".values"),
+			Prefixes: app.Config.GetStringSlice(key + ".prefixes"),
+			Methods:  app.Config.GetStringSlice(key + ".methods"),
+		})
+	}
+
+	return rules
+}
+
+// requiredFor is the header required for the method
+func (rule HeaderRule) requiredFor(method string) bool {
+	if len(rule.Methods) == 0 {
+		return true
+	}
+
+	for _, m := range rule.Methods {
+		if strings.EqualFold(m, method) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// allow is the value accepted by the rule, a rule without values and prefixes accept any value
+func (rule HeaderRule) allow(value string) bool {
+	if len(rule.Values) == 0 && len(rule.Prefixes) == 0 {
+		return true
+	}
+
+	value = strings.ToLower(strings.TrimSpace(value))
+	bare := value
+	if i := strings.IndexByte(bare, ';'); i >= 0 {
+		bare = strings.TrimSpace(bare[:i])
+	}
+
+	for _, v := range rule.Values {
+		if bare == strings.ToLower(v) {
+			return true
+		}
+	}
+
+	for _, p := range rule.Prefixes {
+		if strings.HasPrefix(value, strings.ToLower(p)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// the messages of the refused headers, %s is the header
+const (
+	msgHeaderUndefined = "undefined %s header"
+	msgHeaderWrong     = "wrong value of %s header"
+)
+
+// headerError a header refused by a rule, the message is a catalog key taking the header
+type headerError struct {
+	message string
+	header  string
+}
+
+func (e *headerError) Error() string {
+	return fmt.Sprintf(e.message, e.header)
+}
+
+// check validate the header of the request against the rule
+func (rule HeaderRule) check(r *http.Request) *headerError {
+	value := r.Header.Get(rule.Header)
+	if len(value) == 0 {
+		if rule.requiredFor(r.Method) {
+			return &headerError{msgHeaderUndefined, rule.Header}
+		}
+		return nil
+	}
+
+	if !rule.allow(value) {
+		return &headerError{msgHeaderWrong, rule.Header}
+	}
+
+	return nil
+}
+
+// HeaderCheckerMiddleware check the necesarry headers with the rules of `header_policy`
+// and put the X-CHANNEL value into the request context, read it with GetChannel.
+func (app *App) HeaderCheckerMiddleware(next http.Handler) http.Handler {
+	rules := app.headerRules()
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, rule := range rules {
+			if e := rule.check(r); e != nil {
+				app.SendBadRequestR(w, r, app.T(r, e.message, e.header))
+				return
+			}
+		}
+
+		if channel := r.Header.Get(XChannelHeader); len(channel) > 0 {
+			r = r.WithContext(userContext(r.Context(), channelCtxKey, strings.ToLower(channel)))
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,350 @@
+package bootstrap
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/api/iterator"
+)
+
+const (
+	// MsgUnavailable service is not ready to serve the requests
+	MsgUnavailable = "ERR:SERVICE_UNAVAILABLE"
+
+	healthUp   = "up"
+	healthDown = "down"
+
+	dflHealthTimeout  = 2 * time.Second
+	dflHealthCacheTTL = time.Second
+)
+
+// HealthCheck check one dependency of the app, return nil when it is healthy
+type HealthCheck func(ctx context.Context) error
+
+// HealthResult the last result of a dependency check
+type HealthResult struct {
+	Status     string    `json:"status"`
+	Error      string    `json:"error,omitempty"`
+	DurationMs float64   `json:"duration_ms"`
+	CheckedAt  time.Time `json:"checked_at"`
+}
+
+// HealthReport the readiness report of all dependencies
+type HealthReport struct {
+	Status string                  `json:"status"`
+	Checks map[string]HealthResult `json:"checks"`
+}
+
+type healthEntry struct {
+	name    string
+	check   HealthCheck
+	timeout time.Duration
+
+	mu     sync.Mutex
+	result HealthResult
+}
+
+// Health registry of the dependency checks used by the readiness endpoint
+type Health struct {
+	mu       sync.RWMutex
+	entries  []*healthEntry
+	timeout  time.Duration
+	cacheTTL time.Duration
+
+	closers []func() error
+
+	shuttingDown int32
+}
+
+// NewHealth create the health registry, every check is cut at timeout
+// and its result is reused for cacheTTL so probes do not hammer the dependencies.
+func NewHealth(timeout, cacheTTL time.Duration) *Health {
+	if timeout <= 0 {
+		timeout = dflHealthTimeout
+	}
+	if cacheTTL < 0 {
+		cacheTTL = dflHealthCacheTTL
+	}
+
+	return &Health{timeout: timeout, cacheTTL: cacheTTL}
+}
+
+// Register add a dependency check, timeout 0 use the default timeout of the registry.
+// Registering the same name again replace the previous check.
+func (h *Health) Register(name string, check HealthCheck, timeout time.Duration) {
+	if timeout <= 0 {
+		timeout = h.timeout
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	entry := &healthEntry{name: name, check: check, timeout: timeout}
+	for i, e := range h.entries {
+		if e.name == name {
+			h.entries[i] = entry
+			return
+		}
+	}
+	h.entries = append(h.entries, entry)
+}
+
+// OnClose add a function releasing a resource of a check, run by Close
+func (h *Health) OnClose(fn func() error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.closers = append(h.closers, fn)
+}
+
+// Close release the resources of the checks, the first error is returned
+func (h *Health) Close() error {
+	h.mu.Lock()
+	closers := h.closers
+	h.closers = nil
+	h.mu.Unlock()
+
+	var first error
+	for _, fn := range closers {
+		if err := fn(); err != nil && first == nil {
+			first = err
+		}
+	}
+
+	return first
+}
+
+// SetShuttingDown make the readiness failing, it is called when the graceful shutdown starts
+func (h *Health) SetShuttingDown() {
+	atomic.StoreInt32(&h.shuttingDown, 1)
+}
+
+// IsShuttingDown is the graceful shutdown started
+func (h *Health) IsShuttingDown() bool {
+	return atomic.LoadInt32(&h.shuttingDown) == 1
+}
+
+// Check run every registered check concurrently (or reuse the cached result) and build the report
+func (h *Health) Check(ctx context.Context) HealthReport {
+	h.mu.RLock()
+	entries := make([]*healthEntry, len(h.entries))
+	copy(entries, h.entries)
+	h.mu.RUnlock()
+
+	report := HealthReport{Status: healthUp, Checks: map[string]HealthResult{}}
+	results := make([]HealthResult, len(entries))
+
+	var wg sync.WaitGroup
+	for i, e := range entries {
+		wg.Add(1)
+		go func(i int, e *healthEntry) {
+			defer wg.Done()
+			results[i] = e.run(ctx, h.cacheTTL)
+		}(i, e)
+	}
+	wg.Wait()
+
+	for i, e := range entries {
+		report.Checks[e.name] = results[i]
+		if results[i].Status != healthUp {
+			report.Status = healthDown
+		}
+	}
+
+	if h.IsShuttingDown() {
+		report.Status = healthDown
+	}
+
+	return report
+}
+
+func (e *healthEntry) run(ctx context.Context, cacheTTL time.Duration) HealthResult {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if !e.result.CheckedAt.IsZero() && time.Since(e.result.CheckedAt) < cacheTTL {
+		return e.result
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, e.timeout)
+	defer cancel()
+
+	start := time.Now()
+	err := e.check(ctx)
+	result := HealthResult{
+		Status:     healthUp,
+		DurationMs: sinceMillis(start),
+		CheckedAt:  start,
+	}
+	if err != nil {
+		result.Status = healthDown
+		result.Error = err.Error()
+	}
+	e.result = result
+
+	return result
+}
+
+// SetupHealth create the health registry of the app from the `health` config
+// and register the checks of the connected dependencies.
+func (app *App) SetupHealth() *Health {
+	cacheTTL := dflHealthCacheTTL
+	if app.Config.GetString("health.cache_ttl") != "" {
+		cacheTTL = app.Config.GetDuration("health.cache_ttl")
+	}
+	h := NewHealth(app.Config.GetDuration("health.timeout"), cacheTTL)
+
+	if app.DB != nil {
+		h.Register("postgres", func(ctx context.Context) error {
+			return app.DB.Ping(ctx)
+		}, 0)
+	}
+
+	if app.Redis != nil {
+		h.Register("redis", func(ctx context.Context) error {
+			return app.Redis.Ping(ctx).Err()
+		}, 0)
+	}
+
+	if app.RedisCache != nil {
+		h.Register("redis_cache", func(ctx context.Context) error {
+			return app.RedisCache.Ping(ctx).Err()
+		}, 0)
+	}
+
+	if app.Config.GetBool("health.firestore.enabled") {
+		fc := &firestoreCheck{}
+		h.Register("firestore", fc.Check, 0)
+		h.OnClose(fc.Close)
+	}
+
+	if path := app.Config.GetString("health.disk.path"); len(path) > 0 {
+		minFree := uint64(app.Config.GetInt("health.disk.min_free_mb")) * 1024 * 1024
+		h.Register("disk", diskCheck(path, minFree), 0)
+	}
+
+	app.Health = h
+
+	return h
+}
+
+// firestoreCheck list the first collection with a lazily created client, closed with Health.Close
+type firestoreCheck struct {
+	mu     sync.Mutex
+	client *firestore.Client
+	closed bool
+}
+
+// Check the firestore connection
+func (f *firestoreCheck) Check(ctx context.Context) error {
+	f.mu.Lock()
+	if f.closed {
+		f.mu.Unlock()
+		return fmt.Errorf("firestore client is closed")
+	}
+	if f.client == nil {
+		c, err := newFirestoreClient(context.Background())
+		if err != nil {
+			f.mu.Unlock()
+			return err
+		}
+		f.client = c
+	}
+	client := f.client
+	f.mu.Unlock()
+
+	_, err := client.Collections(ctx).Next()
+	if err == iterator.Done {
+		return nil
+	}
+
+	return err
+}
+
+// Close the client when it was created
+func (f *firestoreCheck) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.closed = true
+	if f.client == nil {
+		return nil
+	}
+
+	err := f.client.Close()
+	f.client = nil
+
+	return err
+}
+
+// diskCheck check the free space of the filesystem that hold path
+func diskCheck(path string, minFree uint64) HealthCheck {
+	return func(ctx context.Context) error {
+		free, err := diskFree(path)
+		if err != nil {
+			return err
+		}
+
+		if free < minFree {
+			return fmt.Errorf("only %d MB free on %s", free/1024/1024, path)
+		}
+
+		return nil
+	}
+}
+
+// LiveAction liveness probe, the process is up and serving
+func (app *App) LiveAction(w http.ResponseWriter, r *http.Request) {
+	app.SendSuccessR(w, r, HealthReport{Status: healthUp, Checks: map[string]HealthResult{}}, nil)
+}
+
+// ReadyAction readiness probe, every dependency is reachable and the app is not shutting down.
+// The errors of the checks are in the report, it is served on the admin listener.
+func (app *App) ReadyAction(w http.ResponseWriter, r *http.Request) {
+	app.ready(w, r, false)
+}
+
+// PublicReadyAction the readiness probe of the public router: the errors of the checks,
+// which may hold hosts or DSN fragments, are logged instead of sent
+func (app *App) PublicReadyAction(w http.ResponseWriter, r *http.Request) {
+	app.ready(w, r, true)
+}
+
+func (app *App) ready(w http.ResponseWriter, r *http.Request, public bool) {
+	if app.Health == nil {
+		app.SendSuccessR(w, r, HealthReport{Status: healthUp, Checks: map[string]HealthResult{}}, nil)
+		return
+	}
+
+	report := app.Health.Check(r.Context())
+	if public {
+		for name, result := range report.Checks {
+			if len(result.Error) == 0 {
+				continue
+			}
+			app.Log.FromDefault().WithContext(r.Context()).WithFields(logrus.Fields{
+				"check": name,
+			}).Warnf("health: %s", result.Error)
+
+			result.Error = ""
+			report.Checks[name] = result
+		}
+	}
+
+	if report.Status != healthUp {
+		msg := "not ready"
+		if app.Health.IsShuttingDown() {
+			msg = "shutting down"
+		}
+		app.RespondWithJSONR(w, r, http.StatusServiceUnavailable, MsgUnavailable, msg, report, app.EmptyJSONArr())
+		return
+	}
+
+	app.SendSuccessR(w, r, report, nil)
+}
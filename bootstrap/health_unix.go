@@ -0,0 +1,16 @@
+//go:build !windows
+// +build !windows
+
+package bootstrap
+
+import "golang.org/x/sys/unix"
+
+// diskFree give the available bytes of the filesystem that hold path
+func diskFree(path string) (uint64, error) {
+	var stat unix.Statfs_t
+	if err := unix.Statfs(path, &stat); err != nil {
+		return 0, err
+	}
+
+	return uint64(stat.Bavail) * uint64(stat.Bsize), nil
+}
@@ -0,0 +1,155 @@
+package bootstrap
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"time"
+
+	"hypefast-api/lib/signature"
+)
+
+const (
+	// XCacheHeader tell whether the response came from the cache
+	XCacheHeader = "X-Cache"
+
+	httpCachePrefix = "http:"
+)
+
+// cachedResponse a GET response kept by CacheMiddleware
+type cachedResponse struct {
+	Status    int                 `json:"status"`
+	Header    map[string][]string `json:"header"`
+	Body      []byte              `json:"body"`
+	ETag      string              `json:"etag"`
+	ExpiresAt time.Time           `json:"expires_at"`
+}
+
+// CacheMiddleware keep the 200 responses of the GET routes in App.Cache for ttl, except the ones setting a cookie.
+// The cache varies on the path, the query, the format (see NegotiateFormat), the channel, the language and the principal of the request,
+// the responses get an ETag (the one of the handler or the hash of the body) and a private Cache-Control, If-None-Match is answered with 304.
+// The cached responses are invalidated with App.Cache.Invalidate of one of the tags.
+func (app *App) CacheMiddleware(ttl time.Duration, tags ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if app.Cache == nil || (r.Method != http.MethodGet && r.Method != http.MethodHead) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			ctx := r.Context()
+			key := app.httpCacheKey(r)
+			w.Header().Add("Vary", XChannelHeader+", "+AuthHeader)
+
+			var cached cachedResponse
+			if ok, err := app.Cache.Get(ctx, key, &cached); err == nil && ok {
+				w.Header().Set(XCacheHeader, "HIT")
+				writeCached(w, r, cached)
+				return
+			}
+
+			// the response is buffered to give it an ETag
+			rec := &bufferedResponse{ResponseWriter: w, status: http.StatusOK}
+			next.ServeHTTP(rec, r)
+
+			// a response that sets a cookie belongs to its client only
+			if rec.status != http.StatusOK || len(w.Header().Values("Set-Cookie")) > 0 {
+				rec.flush()
+				return
+			}
+
+			etag := w.Header().Get("ETag")
+			if len(etag) == 0 {
+				etag = bodyETag(rec.body.Bytes())
+			}
+
+			cached = cachedResponse{
+				Status:    http.StatusOK,
+				Header:    replayableHeader(w.Header()),
+				Body:      rec.body.Bytes(),
+				ETag:      etag,
+				ExpiresAt: time.Now().Add(ttl),
+			}
+			w.Header().Set(XCacheHeader, "MISS")
+			writeCached(w, r, cached)
+
+			if r.Method != http.MethodGet {
+				return
+			}
+
+			if err := app.Cache.Set(ctx, key, cached, ttl, tags...); err != nil {
+				app.Log.FromDefault().WithContext(ctx).Errorf("http cache: %v", err)
+			}
+		})
+	}
+}
+
+// writeCached write the cached response, or 304 when the client has the same version
+func writeCached(w http.ResponseWriter, r *http.Request, cached cachedResponse) {
+	for k, v := range cached.Header {
+		if k == XCacheHeader {
+			continue
+		}
+		w.Header()[k] = v
+	}
+
+	maxAge := ceilSeconds(time.Until(cached.ExpiresAt))
+	if maxAge < 0 {
+		maxAge = 0
+	}
+	w.Header().Set("Cache-Control", "private, max-age="+strconv.Itoa(maxAge))
+	w.Header().Set("ETag", cached.ETag)
+
+	if inm := r.Header.Get("If-None-Match"); len(inm) > 0 && matchETag(inm, cached.ETag, true) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	w.WriteHeader(cached.Status)
+	if r.Method != http.MethodHead {
+		_, _ = w.Write(cached.Body)
+	}
+}
+
+// httpCacheKey the cache key of the request: path, canonical query, format, channel, language and principal
+func (app *App) httpCacheKey(r *http.Request) string {
+	format, err := NegotiateFormat(r)
+	if err != nil {
+		format = r.Header.Get("Accept")
+	}
+
+	h := sha256.New()
+	h.Write([]byte(r.URL.Path + "\n" + signature.CanonicalQuery(r.URL.Query()) + "\n" + format + "\n" +
+		app.GetChannel(r) + "\n" + app.Locale(r) + "\n" + app.principal(r) + "\n" + r.Header.Get(AuthHeader)))
+
+	return httpCachePrefix + hex.EncodeToString(h.Sum(nil))
+}
+
+// bufferedResponse hold the status and body of the response until flush
+type bufferedResponse struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+	body        bytes.Buffer
+}
+
+func (b *bufferedResponse) WriteHeader(status int) {
+	if b.wroteHeader {
+		return
+	}
+	b.wroteHeader = true
+	b.status = status
+}
+
+func (b *bufferedResponse) Write(p []byte) (int, error) {
+	b.wroteHeader = true
+	return b.body.Write(p)
+}
+
+// flush write the buffered response as it is
+func (b *bufferedResponse) flush() {
+	b.ResponseWriter.WriteHeader(b.status)
+	_, _ = b.ResponseWriter.Write(b.body.Bytes())
+}
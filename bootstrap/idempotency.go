@@ -0,0 +1,259 @@
+package bootstrap
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"hypefast-api/lib/signature"
+	"hypefast-api/lib/tracing"
+
+	"github.com/go-chi/chi/middleware"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// IdempotencyKeyHeader the client chosen key of an unsafe request
+	IdempotencyKeyHeader = "Idempotency-Key"
+
+	// IdempotentReplayedHeader set on a response replayed from the stored one
+	IdempotentReplayedHeader = "Idempotent-Replayed"
+
+	// MsgConflict the request conflict with the current state of the resource
+	MsgConflict = "ERR:CONFLICT"
+
+	// MsgIdempotencyKeyReused the idempotency key was used for another payload
+	MsgIdempotencyKeyReused = "ERR:IDEMPOTENCY_KEY_REUSED"
+
+	idempotencyPrefix     = "idempotency:"
+	idempotencyProcessing = "processing"
+	idempotencyDone       = "done"
+
+	dflIdempotencyTTL     = 24 * time.Hour
+	dflIdempotencyLockTTL = time.Minute
+	maxIdempotencyKeyLen  = 255
+)
+
+// idempotencyRecord the state of an idempotency key stored in Redis
+type idempotencyRecord struct {
+	State       string              `json:"state"`
+	Fingerprint string              `json:"fingerprint"`
+	Status      int                 `json:"status,omitempty"`
+	Header      map[string][]string `json:"header,omitempty"`
+	Body        []byte              `json:"body,omitempty"`
+}
+
+// IdempotencyMiddleware honour the Idempotency-Key header on POST, PUT and PATCH.
+//
+// The first request of a key (per principal) is processed and its response is kept
+// for `idempotency.ttl` (default 24h), a retry with the same key get the stored response back.
+// A retry while the first request is in flight get 409, and a key reused with another
+// method, path or body get 422. A 5xx response is not kept so the client can retry it.
+func (app *App) IdempotencyMiddleware(next http.Handler) http.Handler {
+	ttl := app.durationConfig("idempotency.ttl", dflIdempotencyTTL)
+	lockTTL := app.durationConfig("idempotency.lock_ttl", dflIdempotencyLockTTL)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(IdempotencyKeyHeader)
+		if len(key) == 0 || app.Redis == nil || !isUnsafeMethod(r.Method) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if len(key) > maxIdempotencyKeyLen {
+			app.SendBadRequestR(w, r, "Idempotency-Key is too long")
+			return
+		}
+
+		body, err := signature.ReadBody(r)
+		if err != nil {
+			app.SendBindErrorR(w, r, err)
+			return
+		}
+
+		ctx := r.Context()
+		redisKey := idempotencyPrefix + app.principal(r) + ":" + key
+		fingerprint := requestFingerprint(r, body)
+
+		lock, _ := json.Marshal(idempotencyRecord{State: idempotencyProcessing, Fingerprint: fingerprint})
+		fresh, err := app.Redis.SetNX(ctx, redisKey, lock, lockTTL).Result()
+		if err != nil {
+			app.Log.FromDefault().WithContext(ctx).Errorf("idempotency: %v", err)
+			app.RespondWithJSONR(w, r, http.StatusServiceUnavailable, MsgUnavailable, "cannot process the request", app.EmptyJSONArr(), app.EmptyJSONArr())
+			return
+		}
+
+		if !fresh {
+			app.replayIdempotent(w, r, redisKey, fingerprint)
+			return
+		}
+
+		// the headers are recorded as the handler wrote them, the middlewares in front
+		// (e.g. CompressMiddleware) change them for the body they send, not the one recorded
+		snap := &headerSnapshot{ResponseWriter: w}
+		ww := middleware.NewWrapResponseWriter(snap, r.ProtoMajor)
+		buf := &bytes.Buffer{}
+		ww.Tee(buf)
+
+		stored := false
+		defer func() {
+			// release the key when the handler panic or fail, so the client can retry
+			if !stored {
+				app.Redis.Del(context.Background(), redisKey)
+			}
+		}()
+
+		next.ServeHTTP(ww, r)
+
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+		if status >= http.StatusInternalServerError {
+			return
+		}
+
+		record, _ := json.Marshal(idempotencyRecord{
+			State:       idempotencyDone,
+			Fingerprint: fingerprint,
+			Status:      status,
+			Header:      replayableHeader(snap.Header()),
+			Body:        buf.Bytes(),
+		})
+		if err := app.Redis.Set(ctx, redisKey, record, ttl).Err(); err != nil {
+			app.Log.FromDefault().WithContext(ctx).WithFields(logrus.Fields{
+				"key": key,
+			}).Errorf("idempotency: store the response: %v", err)
+			return
+		}
+		stored = true
+	})
+}
+
+// replayIdempotent answer a retry with the stored response of the key
+func (app *App) replayIdempotent(w http.ResponseWriter, r *http.Request, redisKey, fingerprint string) {
+	raw, err := app.Redis.Get(r.Context(), redisKey).Bytes()
+	if err != nil {
+		// the first request just released the key
+		app.RespondWithJSONR(w, r, http.StatusConflict, MsgConflict, "a request with the same Idempotency-Key is in progress", app.EmptyJSONArr(), app.EmptyJSONArr())
+		return
+	}
+
+	var record idempotencyRecord
+	if err := json.Unmarshal(raw, &record); err != nil {
+		app.Log.FromDefault().WithContext(r.Context()).Errorf("idempotency: invalid record: %v", err)
+		app.RespondWithJSONR(w, r, http.StatusConflict, MsgConflict, "a request with the same Idempotency-Key is in progress", app.EmptyJSONArr(), app.EmptyJSONArr())
+		return
+	}
+
+	if record.Fingerprint != fingerprint {
+		app.RespondWithJSONR(w, r, http.StatusUnprocessableEntity, MsgIdempotencyKeyReused, "Idempotency-Key was already used for another request", app.EmptyJSONArr(), app.EmptyJSONArr())
+		return
+	}
+
+	if record.State != idempotencyDone {
+		app.RespondWithJSONR(w, r, http.StatusConflict, MsgConflict, "a request with the same Idempotency-Key is in progress", app.EmptyJSONArr(), app.EmptyJSONArr())
+		return
+	}
+
+	for k, v := range record.Header {
+		w.Header()[k] = v
+	}
+	w.Header().Set(IdempotentReplayedHeader, "true")
+	w.WriteHeader(record.Status)
+	_, _ = w.Write(record.Body)
+}
+
+// principal who sent the request: the member when mounted after VerifyJwtToken, the client verified
+// by SignatureMiddleware or the client ip. On /v1/api it runs before any jwt check, there is no member.
+func (app *App) principal(r *http.Request) string {
+	if mcode, ok := r.Context().Value("mcode").(string); ok && len(mcode) > 0 {
+		return "member:" + mcode
+	}
+
+	if client, ok := r.Context().Value(clientCtxKey).(string); ok && len(client) > 0 {
+		return "client:" + client
+	}
+
+	return "ip:" + clientIP(r)
+}
+
+// requestFingerprint the hash of the method, path, query and body of the request
+func requestFingerprint(r *http.Request, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(r.Method + "\n" + r.URL.Path + "\n" + signature.CanonicalQuery(r.URL.Query()) + "\n"))
+	h.Write(body)
+
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// replayableHeader the response headers that belong to the response itself,
+// not to the request that produced it. The cookies are never stored nor replayed,
+// Vary is left to the middlewares that add it on every request.
+func replayableHeader(header http.Header) map[string][]string {
+	result := make(map[string][]string, len(header))
+	for k, v := range header {
+		if k == tracing.TraceIDHeader || k == "Date" || k == "Set-Cookie" || k == "Vary" || k == "Retry-After" || strings.HasPrefix(k, "X-Ratelimit-") {
+			continue
+		}
+		result[k] = v
+	}
+
+	return result
+}
+
+// headerSnapshot copy the headers when the handler write the response,
+// before the writers it wraps change them
+type headerSnapshot struct {
+	http.ResponseWriter
+	header http.Header
+}
+
+// Header the copy of the written headers, the live ones until the response is written
+func (s *headerSnapshot) Header() http.Header {
+	if s.header != nil {
+		return s.header
+	}
+
+	return s.ResponseWriter.Header()
+}
+
+func (s *headerSnapshot) WriteHeader(status int) {
+	s.snapshot()
+	s.ResponseWriter.WriteHeader(status)
+}
+
+func (s *headerSnapshot) Write(p []byte) (int, error) {
+	s.snapshot()
+	return s.ResponseWriter.Write(p)
+}
+
+func (s *headerSnapshot) Flush() {
+	if f, ok := s.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (s *headerSnapshot) snapshot() {
+	if s.header == nil {
+		s.header = s.ResponseWriter.Header().Clone()
+	}
+}
+
+func isUnsafeMethod(method string) bool {
+	return method == http.MethodPost || method == http.MethodPut || method == http.MethodPatch
+}
+
+// durationConfig the duration of key, dfl when it is not set
+func (app *App) durationConfig(key string, dfl time.Duration) time.Duration {
+	if d := app.Config.GetDuration(key); d > 0 {
+		return d
+	}
+
+	return dfl
+}
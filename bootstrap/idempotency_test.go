@@ -0,0 +1,109 @@
+package bootstrap
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+)
+
+// newRedisApp an app with the config of the json document and a redis server in memory
+func newRedisApp(t *testing.T, config string) *App {
+	t.Helper()
+
+	srv, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(srv.Close)
+
+	app := newConfigApp(t, config)
+	app.Redis = redis.NewClient(&redis.Options{Addr: srv.Addr()})
+	t.Cleanup(func() { app.Redis.Close() })
+
+	return app
+}
+
+func TestIdempotencyReplayThroughCompress(t *testing.T) {
+	app := newRedisApp(t, `{"compress": {"min_size": 16}}`)
+
+	body := `{"order":"` + strings.Repeat("x", 64) + `"}`
+	calls := 0
+	handler := app.CompressMiddleware()(app.IdempotencyMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("ETag", `"abc"`)
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte(body))
+	})))
+
+	send := func(acceptEncoding string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/v1/api/orders", strings.NewReader(`{"sku":"a"}`))
+		r.Header.Set(IdempotencyKeyHeader, "key-1")
+		if len(acceptEncoding) > 0 {
+			r.Header.Set("Accept-Encoding", acceptEncoding)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, r)
+		return rec
+	}
+
+	tests := []struct {
+		name           string
+		acceptEncoding string
+		replayed       bool
+		encoding       string
+		etag           string
+	}{
+		{name: "first request", acceptEncoding: "gzip", encoding: "gzip", etag: `"abc-gzip"`},
+		{name: "replay compressed", acceptEncoding: "gzip", replayed: true, encoding: "gzip", etag: `"abc-gzip"`},
+		{name: "replay identity", replayed: true, etag: `"abc"`},
+	}
+
+	for _, tt := range tests {
+		rec := send(tt.acceptEncoding)
+
+		if rec.Code != http.StatusCreated {
+			t.Fatalf("%s: status = %d, want 201", tt.name, rec.Code)
+		}
+		if got := rec.Header().Get(IdempotentReplayedHeader) == "true"; got != tt.replayed {
+			t.Errorf("%s: replayed = %v, want %v", tt.name, got, tt.replayed)
+		}
+		if got := rec.Header().Get("Content-Encoding"); got != tt.encoding {
+			t.Errorf("%s: Content-Encoding = %q, want %q", tt.name, got, tt.encoding)
+		}
+		if got := rec.Header().Get("ETag"); got != tt.etag {
+			t.Errorf("%s: ETag = %q, want %q", tt.name, got, tt.etag)
+		}
+		if len(tt.encoding) > 0 {
+			if vary := rec.Header().Values("Vary"); len(vary) != 1 || vary[0] != "Accept-Encoding" {
+				t.Errorf("%s: Vary = %v, want [Accept-Encoding]", tt.name, vary)
+			}
+		}
+
+		got := rec.Body.String()
+		if tt.encoding == "gzip" {
+			zr, err := gzip.NewReader(rec.Body)
+			if err != nil {
+				t.Fatalf("%s: the body is not gzip: %v", tt.name, err)
+			}
+			raw, err := ioutil.ReadAll(zr)
+			if err != nil {
+				t.Fatalf("%s: %v", tt.name, err)
+			}
+			got = string(raw)
+		}
+		if got != body {
+			t.Errorf("%s: body = %q, want %q", tt.name, got, body)
+		}
+	}
+
+	if calls != 1 {
+		t.Errorf("handler called %d times, want 1", calls)
+	}
+}
@@ -0,0 +1,209 @@
+package bootstrap
+
+import (
+	"net/http"
+
+	"hypefast-api/lib/i18n"
+	"hypefast-api/lib/utils"
+
+	ut "github.com/go-playground/universal-translator"
+)
+
+const (
+	// ContentLanguageHeader the language of the response, set by LocaleMiddleware
+	ContentLanguageHeader = "Content-Language"
+
+	dflLocale = "en"
+
+	localeCtxKey = "locale"
+)
+
+// dflMessages the catalog of the response messages, the key of an envelope message is its english text
+// and the key of an apperr.Error is its message key
+var dflMessages = map[string]map[string]string{
+	"en": {
+		"Success":                           "Success",
+		"validation error":                  "validation error",
+		"unauthorized data":                 "unauthorized data",
+		"Sorry. We couldn't find that page": "Sorry. We couldn't find that page",
+		"Something error with our system. Please contact our administrator with the incident id": "Something error with our system. Please contact our administrator with the incident id",
+		"request body too large":                                 "request body too large",
+		"invalid gzip request body":                              "invalid gzip request body",
+		"unsupported Content-Encoding %s":                        "unsupported Content-Encoding %s",
+		"the request took longer than %s":                        "the request took longer than %s",
+		"too many requests, please try again later":              "too many requests, please try again later",
+		"the resource was changed, reload it and try again":      "the resource was changed, reload it and try again",
+		"shutting down":                                          "shutting down",
+		"cannot process the request":                             "cannot process the request",
+		"cannot verify the request":                              "cannot verify the request",
+		"client certificate is required":                         "client certificate is required",
+		"unknown client":                                         "unknown client",
+		"invalid timestamp":                                      "invalid timestamp",
+		"expired signature":                                      "expired signature",
+		"undefined nonce":                                        "undefined nonce",
+		"invalid signature":                                      "invalid signature",
+		"replayed request":                                       "replayed request",
+		"Idempotency-Key is too long":                            "Idempotency-Key is too long",
+		"Idempotency-Key was already used for another request":   "Idempotency-Key was already used for another request",
+		"a request with the same Idempotency-Key is in progress": "a request with the same Idempotency-Key is in progress",
+		"page must be a positive integer":                        "page must be a positive integer",
+		"limit must be a positive integer":                       "limit must be a positive integer",
+		"page is too large":                                      "page is too large",
+		"invalid cursor":                                         "invalid cursor",
+		"invalid JSON body":                                      "invalid JSON body",
+		"unsupported Content-Type %s":                            "unsupported Content-Type %s",
+		"[] is not a known field":                                "[] is not a known field",
+		"[] has an invalid value":                                "[] has an invalid value",
+		"[] must be a number":                                    "[] must be a number",
+		"[] must be true or false":                               "[] must be true or false",
+		"[] must be a RFC 3339 time":                             "[] must be a RFC 3339 time",
+		"[] must be a string":                                    "[] must be a string",
+		"[] must be an object":                                   "[] must be an object",
+		"[] must be an array":                                    "[] must be an array",
+		"the requested format is not supported":                  "the requested format is not supported",
+		"undefined %s header":                                    "undefined %s header",
+		"wrong value of %s header":                               "wrong value of %s header",
+		"fields must be fields of the data":                      "fields must be fields of the data",
+
+		"not_found":  "data not found",
+		"duplicate":  "data already exists",
+		"referenced": "data is referenced by other data",
+		"invalid":    "data is not valid",
+		"timeout":    "the request took too long",
+		"canceled":   "the request was canceled",
+		"internal":   "Something error with our system. Please contact our administrator with the incident id",
+	},
+	"id": {
+		"Success":                           "Berhasil",
+		"validation error":                  "data tidak valid",
+		"unauthorized data":                 "data tidak diizinkan",
+		"Sorry. We couldn't find that page": "Maaf. Halaman yang Anda cari tidak ditemukan",
+		"Something error with our system. Please contact our administrator with the incident id": "Terjadi kesalahan pada sistem kami. Silakan hubungi administrator kami dengan menyertakan incident id",
+		"request body too large":                                 "ukuran request body terlalu besar",
+		"invalid gzip request body":                              "request body gzip tidak valid",
+		"unsupported Content-Encoding %s":                        "Content-Encoding %s tidak didukung",
+		"the request took longer than %s":                        "request memakan waktu lebih dari %s",
+		"too many requests, please try again later":              "terlalu banyak request, silakan coba lagi nanti",
+		"the resource was changed, reload it and try again":      "data telah berubah, muat ulang lalu coba lagi",
+		"shutting down":                                          "server sedang dimatikan",
+		"cannot process the request":                             "request tidak dapat diproses",
+		"cannot verify the request":                              "request tidak dapat diverifikasi",
+		"client certificate is required":                         "sertifikat klien wajib disertakan",
+		"unknown client":                                         "klien tidak dikenal",
+		"invalid timestamp":                                      "timestamp tidak valid",
+		"expired signature":                                      "signature sudah kedaluwarsa",
+		"undefined nonce":                                        "nonce tidak ditemukan",
+		"invalid signature":                                      "signature tidak valid",
+		"replayed request":                                       "request sudah pernah dikirim",
+		"Idempotency-Key is too long":                            "Idempotency-Key terlalu panjang",
+		"Idempotency-Key was already used for another request":   "Idempotency-Key sudah digunakan untuk request lain",
+		"a request with the same Idempotency-Key is in progress": "request dengan Idempotency-Key yang sama sedang diproses",
+		"page must be a positive integer":                        "page harus berupa bilangan bulat positif",
+		"limit must be a positive integer":                       "limit harus berupa bilangan bulat positif",
+		"page is too large":                                      "page terlalu besar",
+		"invalid cursor":                                         "cursor tidak valid",
+		"invalid JSON body":                                      "request body bukan JSON yang valid",
+		"unsupported Content-Type %s":                            "Content-Type %s tidak didukung",
+		"[] is not a known field":                                "[] bukan field yang dikenal",
+		"[] has an invalid value":                                "nilai [] tidak valid",
+		"[] must be a number":                                    "[] harus berupa angka",
+		"[] must be true or false":                               "[] harus berupa true atau false",
+		"[] must be a RFC 3339 time":                             "[] harus berupa waktu RFC 3339",
+		"[] must be a string":                                    "[] harus berupa teks",
+		"[] must be an object":                                   "[] harus berupa object",
+		"[] must be an array":                                    "[] harus berupa array",
+		"the requested format is not supported":                  "format yang diminta tidak didukung",
+		"undefined %s header":                                    "header %s wajib diisi",
+		"wrong value of %s header":                               "nilai header %s tidak valid",
+		"fields must be fields of the data":                      "fields harus berisi field dari data",
+
+		"not_found":  "data tidak ditemukan",
+		"duplicate":  "data sudah ada",
+		"referenced": "data masih digunakan oleh data lain",
+		"invalid":    "data tidak valid",
+		"timeout":    "request memakan waktu terlalu lama",
+		"canceled":   "request dibatalkan",
+		"internal":   "Terjadi kesalahan pada sistem kami. Silakan hubungi administrator kami dengan menyertakan incident id",
+	},
+}
+
+// SetupI18n create the message catalog, `app.locale` is the language of the clients
+// that accept none of the catalog (default en)
+func SetupI18n(config utils.Config) *i18n.Catalog {
+	fallback := config.GetString("app.locale")
+	if len(fallback) == 0 {
+		fallback = dflLocale
+	}
+
+	catalog := i18n.New(fallback)
+	for lang, messages := range dflMessages {
+		catalog.Add(lang, messages)
+	}
+
+	return catalog
+}
+
+// LocaleMiddleware negotiate the language of the response from Accept-Language among the languages
+// of the catalog, falling back to `app.locale`. The language is kept in the request context and
+// the Content-Language header, RespondWithJSON translate the stat_msg with it.
+func (app *App) LocaleMiddleware(next http.Handler) http.Handler {
+	supported := app.I18n.Languages()
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lang := i18n.Negotiate(r.Header.Get("Accept-Language"), supported)
+		if len(lang) == 0 {
+			lang = app.defaultLocale()
+		}
+
+		w.Header().Add("Vary", "Accept-Language")
+		w.Header().Set(ContentLanguageHeader, lang)
+
+		next.ServeHTTP(w, r.WithContext(userContext(r.Context(), localeCtxKey, lang)))
+	})
+}
+
+// Locale the language of the request negotiated by LocaleMiddleware, the default one without a request
+func (h *App) Locale(r *http.Request) string {
+	if r == nil {
+		return h.defaultLocale()
+	}
+
+	if lang, ok := r.Context().Value(localeCtxKey).(string); ok && len(lang) > 0 {
+		return lang
+	}
+
+	return h.defaultLocale()
+}
+
+// T translate the message key in the language of the request
+func (h *App) T(r *http.Request, key string, args ...interface{}) string {
+	return h.I18n.Translate(h.Locale(r), key, args...)
+}
+
+func (h *App) defaultLocale() string {
+	if lang := h.I18n.Fallback(); len(lang) > 0 {
+		return lang
+	}
+
+	return dflLocale
+}
+
+// translateMessage the message in the language of the request, as it is when the catalog does not know it
+func (h *App) translateMessage(r *http.Request, message string) string {
+	if msg, ok := h.I18n.Lookup(h.Locale(r), message); ok {
+		return msg
+	}
+
+	return message
+}
+
+// TranslatorFor the validation translator of the language, the default one when it is not registered
+func (v *Validator) TranslatorFor(lang string) ut.Translator {
+	if v.Uni != nil {
+		if trans, found := v.Uni.GetTranslator(lang); found {
+			return trans
+		}
+	}
+
+	return v.Translator
+}
@@ -0,0 +1,60 @@
+package bootstrap
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// registry give the private prometheus registry of the app,
+// create it when the app is built without SetupMetrics.
+func (app *App) registry() *prometheus.Registry {
+	if app.Metrics == nil {
+		app.Metrics = SetupMetrics()
+	}
+
+	return app.Metrics
+}
+
+// registerCollector register the collector into the app registry.
+// When an equal collector is already registered the existing one is returned,
+// so building the same middleware twice does not panic.
+func (app *App) registerCollector(c prometheus.Collector) prometheus.Collector {
+	if err := app.registry().Register(c); err != nil {
+		if are, ok := err.(prometheus.AlreadyRegisteredError); ok {
+			return are.ExistingCollector
+		}
+		panic(err)
+	}
+
+	return c
+}
+
+// latencyBuckets read the latency buckets (in milliseconds) from `metrics.buckets`,
+// fallback into dflBuckets when it is empty or invalid.
+func (app *App) latencyBuckets() []float64 {
+	raw := app.Config.GetStringSlice("metrics.buckets")
+	if len(raw) == 0 {
+		return dflBuckets
+	}
+
+	buckets := make([]float64, 0, len(raw))
+	for _, v := range raw {
+		b, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			log.Printf("[metrics] invalid bucket %q, using default buckets", v)
+			return dflBuckets
+		}
+		buckets = append(buckets, b)
+	}
+
+	return buckets
+}
+
+// MetricsHandler serve the collected metrics of the app registry
+func (app *App) MetricsHandler() http.Handler {
+	return promhttp.HandlerFor(app.registry(), promhttp.HandlerOpts{})
+}
@@ -2,16 +2,18 @@ package bootstrap
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"fmt"
-	"hypefast-api/lib/utils"
 	"net/http"
+	"os"
 	"runtime/debug"
-	"strings"
 	"time"
 
 	"github.com/dgrijalva/jwt-go"
 	"github.com/go-chi/chi"
 	"github.com/go-chi/chi/middleware"
+	"github.com/go-chi/valve"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/sirupsen/logrus"
 )
@@ -28,11 +30,6 @@ type RegisterClaims struct {
 	jwt.StandardClaims
 }
 
-var (
-	mustHeader = []string{"X-Channel", "Content-Type"}
-	headerVal  = []string{"webtraveller", "webcms", "application/json"}
-)
-
 func userContext(ctx context.Context, subject, id interface{}) context.Context {
 	return context.WithValue(ctx, subject, id)
 }
@@ -50,7 +47,7 @@ func (app *App) NotfoundMiddleware(next http.Handler) http.Handler {
 		rctx := chi.RouteContext(r.Context())
 
 		if !rctx.Routes.Match(tctx, r.Method, r.URL.Path) {
-			app.SendNotfound(w, "Sorry. We couldn't find that page")
+			app.SendNotfoundR(w, r, "Sorry. We couldn't find that page")
 			return
 		}
 
@@ -58,23 +55,30 @@ func (app *App) NotfoundMiddleware(next http.Handler) http.Handler {
 	})
 }
 
-// Recoverer ...
+// Recoverer answer a panic of the handler with a 500 ERR:INTERNAL response holding an incident id,
+// the same id is the Sentry event id and the incident_id of the log line.
+// http.ErrAbortHandler is panicked again to abort the response as net/http does.
 func (app *App) Recoverer(next http.Handler) http.Handler {
+	panics := app.panicCounter()
+
 	fn := func(w http.ResponseWriter, r *http.Request) {
 		defer func() {
 			if rvr := recover(); rvr != nil {
-				logEntry := middleware.GetLogEntry(r)
-				if logEntry != nil {
-					logEntry.Panic(rvr, debug.Stack())
-				} else {
-					debug.PrintStack()
+				if rvr == http.ErrAbortHandler {
+					panic(rvr)
+				}
+
+				stack := debug.Stack()
+				if p, ok := rvr.(handlerPanic); ok {
+					rvr, stack = p.value, p.stack
 				}
 
-				app.Log.FromDefault().WithFields(logrus.Fields{
-					"Panic": rvr,
-				}).Errorf("Panic: %v \n %v", rvr, string(debug.Stack()))
+				incidentID := app.reportPanic(panics, r, rvr, stack)
 
-				app.SendBadRequest(w, "Something error with our system. Please contact our administrator")
+				w.Header().Set(XIncidentID, incidentID)
+				app.RespondWithJSONR(w, r, http.StatusInternalServerError, MsgInternal,
+					"Something error with our system. Please contact our administrator with the incident id",
+					errorData{IncidentID: incidentID}, app.EmptyJSONArr())
 				return
 			}
 		}()
@@ -85,6 +89,80 @@ func (app *App) Recoverer(next http.Handler) http.Handler {
 	return http.HandlerFunc(fn)
 }
 
+// panicCounter the counter of the recovered panics
+func (app *App) panicCounter() *prometheus.CounterVec {
+	return app.registerCollector(prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: panicsName,
+		Help: "How many handler panics were recovered, partitioned by method and route pattern.",
+	}, []string{"method", "path"})).(*prometheus.CounterVec)
+}
+
+// reportPanic log the panic with its stack and count it, return the incident id of the log line
+func (app *App) reportPanic(panics *prometheus.CounterVec, r *http.Request, rvr interface{}, stack []byte) string {
+	logEntry := middleware.GetLogEntry(r)
+	if logEntry != nil {
+		logEntry.Panic(rvr, stack)
+	} else {
+		_, _ = os.Stderr.Write(stack)
+	}
+
+	incidentID := newIncidentID()
+	panics.WithLabelValues(r.Method, routePattern(r)).Inc()
+
+	app.Log.FromDefault().WithContext(r.Context()).WithFields(logrus.Fields{
+		"Panic":       rvr,
+		"event_id":    incidentID,
+		"incident_id": incidentID,
+		"method":      r.Method,
+		"path":        r.URL.Path,
+	}).Errorf("Panic: %v \n %v", rvr, string(stack))
+
+	return incidentID
+}
+
+// newIncidentID a random 32 hex id, the format of a Sentry event id
+func newIncidentID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("%032x", time.Now().UnixNano())
+	}
+
+	return hex.EncodeToString(b)
+}
+
+// ValveMiddleware hold the shutdown valve while the handler runs, so the graceful shutdown
+// waits for long handlers. Requests that come after the shutdown started are refused.
+func (app *App) ValveMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Context().Value(valve.ValveCtxKey) == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		lever := valve.Lever(r.Context())
+		if err := lever.Open(); err != nil {
+			app.RespondWithJSONR(w, r, http.StatusServiceUnavailable, MsgUnavailable, "shutting down", app.EmptyJSONArr(), app.EmptyJSONArr())
+			return
+		}
+		defer lever.Close()
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// RequireClientCert allow only the internal callers that present a client certificate
+// verified by the mutual TLS of the server (`server.tls.client_ca_file`).
+func (app *App) RequireClientCert(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 {
+			app.SendAuthErrorR(w, r, "client certificate is required")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
 // VerifyJwtToken ...
 func (app *App) VerifyJwtToken(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -107,7 +185,7 @@ func (app *App) VerifyJwtToken(next http.Handler) http.Handler {
 				}
 			}
 
-			app.SendAuthError(w, msg)
+			app.SendAuthErrorR(w, r, msg)
 			return
 		}
 
@@ -140,7 +218,7 @@ func (app *App) VerifyJwtTokenRegister(next http.Handler) http.Handler {
 				}
 			}
 
-			app.SendAuthError(w, msg)
+			app.SendAuthErrorR(w, r, msg)
 			return
 		}
 
@@ -149,76 +227,110 @@ func (app *App) VerifyJwtTokenRegister(next http.Handler) http.Handler {
 	})
 }
 
-// HeaderCheckerMiddleware check the necesarry headers
-func (app *App) HeaderCheckerMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		for _, v := range mustHeader {
-			if len(r.Header.Get(v)) == 0 || !utils.Contains(headerVal, r.Header.Get(v)) {
-				app.SendBadRequest(w, fmt.Sprintf("undefined %s header or wrong value of header", v))
-				return
-			}
-		}
-
-		next.ServeHTTP(w, r)
-	})
-}
-
 // promotheus section
 // https://github.com/766b/chi-prometheus/blob/master/middleware.go
 
 var (
-	dflBuckets = []float64{300, 1200, 5000}
+	dflBuckets     = []float64{300, 1200, 5000}
+	dflSizeBuckets = prometheus.ExponentialBuckets(100, 10, 6)
 )
 
 const (
-	reqsName           = "chi_requests_total"
-	latencyName        = "chi_request_duration_milliseconds"
-	patternReqsName    = "chi_pattern_requests_total"
-	patternLatencyName = "chi_pattern_request_duration_milliseconds"
+	reqsName             = "chi_requests_total"
+	latencyName          = "chi_request_duration_milliseconds"
+	sizeName             = "chi_response_size_bytes"
+	inFlightName         = "chi_requests_in_flight"
+	panicsName           = "http_panics_total"
+	patternReqsName      = "chi_pattern_requests_total"
+	patternLatencyName   = "chi_pattern_request_duration_milliseconds"
+	patternSizeName      = "chi_pattern_response_size_bytes"
+	patternInFlightName  = "chi_pattern_requests_in_flight"
+	promLabelDescription = "partitioned by status code, method and HTTP path"
 )
 
 // Middleware is a handler that exposes prometheus metrics for the number of requests,
 // the latency and the response size, partitioned by status code, method and HTTP path.
 type PromotMiddleware struct {
-	reqs    *prometheus.CounterVec
-	latency *prometheus.HistogramVec
+	reqs     *prometheus.CounterVec
+	latency  *prometheus.HistogramVec
+	size     *prometheus.HistogramVec
+	inFlight prometheus.Gauge
 }
 
-// NewPrometMiddleware returns a new prometheus Middleware handler.
-func (app *App) NewPrometMiddleware(name string, buckets ...float64) func(next http.Handler) http.Handler {
+// promMetricNames names of the collectors that build one PromotMiddleware
+type promMetricNames struct {
+	reqs, latency, size, inFlight, suffix string
+}
+
+// newPromotMiddleware register the collectors of the middleware into the app registry.
+// Collectors that already registered (the middleware was built before) are reused.
+func (app *App) newPromotMiddleware(name string, names promMetricNames, buckets []float64) PromotMiddleware {
 	var m PromotMiddleware
-	m.reqs = prometheus.NewCounterVec(
+	labels := []string{"code", "method", "path", "channel"}
+	constLabels := prometheus.Labels{"service": name}
+
+	m.reqs = app.registerCollector(prometheus.NewCounterVec(
 		prometheus.CounterOpts{
-			Name:        reqsName,
-			Help:        "How many HTTP requests processed, partitioned by status code, method and HTTP path.",
-			ConstLabels: prometheus.Labels{"service": name},
+			Name:        names.reqs,
+			Help:        "How many HTTP requests processed, " + promLabelDescription + names.suffix + ".",
+			ConstLabels: constLabels,
 		},
-		[]string{"code", "method", "path", "channel"},
-	)
-	prometheus.MustRegister(m.reqs)
+		labels,
+	)).(*prometheus.CounterVec)
 
 	if len(buckets) == 0 {
-		buckets = dflBuckets
+		buckets = app.latencyBuckets()
 	}
-	m.latency = prometheus.NewHistogramVec(prometheus.HistogramOpts{
-		Name:        latencyName,
-		Help:        "How long it took to process the request, partitioned by status code, method and HTTP path.",
-		ConstLabels: prometheus.Labels{"service": name},
+	m.latency = app.registerCollector(prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:        names.latency,
+		Help:        "How long it took to process the request, " + promLabelDescription + names.suffix + ".",
+		ConstLabels: constLabels,
 		Buckets:     buckets,
 	},
-		[]string{"code", "method", "path", "channel"},
-	)
-	prometheus.MustRegister(m.latency)
+		labels,
+	)).(*prometheus.HistogramVec)
+
+	m.size = app.registerCollector(prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:        names.size,
+		Help:        "How big the response body was in bytes, " + promLabelDescription + names.suffix + ".",
+		ConstLabels: constLabels,
+		Buckets:     dflSizeBuckets,
+	},
+		labels,
+	)).(*prometheus.HistogramVec)
+
+	m.inFlight = app.registerCollector(prometheus.NewGauge(prometheus.GaugeOpts{
+		Name:        names.inFlight,
+		Help:        "How many HTTP requests are currently being processed.",
+		ConstLabels: constLabels,
+	})).(prometheus.Gauge)
+
+	return m
+}
+
+// NewPrometMiddleware returns a new prometheus Middleware handler.
+func (app *App) NewPrometMiddleware(name string, buckets ...float64) func(next http.Handler) http.Handler {
+	m := app.newPromotMiddleware(name, promMetricNames{
+		reqs:     reqsName,
+		latency:  latencyName,
+		size:     sizeName,
+		inFlight: inFlightName,
+	}, buckets)
+
 	return m.handler
 }
 
 func (c PromotMiddleware) handler(next http.Handler) http.Handler {
 	fn := func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
+		c.inFlight.Inc()
+		defer c.inFlight.Dec()
+
+		r, outcome := withTimeoutOutcome(r)
 		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
 		next.ServeHTTP(ww, r)
-		c.reqs.WithLabelValues(http.StatusText(ww.Status()), r.Method, r.URL.Path, r.Header.Get("X-CHANNEL")).Inc()
-		c.latency.WithLabelValues(http.StatusText(ww.Status()), r.Method, r.URL.Path, r.Header.Get("X-CHANNEL")).Observe(float64(time.Since(start).Nanoseconds()) / 1000000)
+
+		c.observe(ww, r, r.URL.Path, start, outcome)
 	}
 	return http.HandlerFunc(fn)
 }
@@ -227,46 +339,42 @@ func (c PromotMiddleware) handler(next http.Handler) http.Handler {
 // https://github.com/edjumacator/chi-prometheus/blob/add-route-pattern-support/pattern_example/main.go
 // EX: /users/{firstName} instead of /users/bob
 func (app *App) NewPrometPatternMiddleware(name string, buckets ...float64) func(next http.Handler) http.Handler {
-	var m PromotMiddleware
-	m.reqs = prometheus.NewCounterVec(
-		prometheus.CounterOpts{
-			Name:        patternReqsName,
-			Help:        "How many HTTP requests processed, partitioned by status code, method and HTTP path (with patterns).",
-			ConstLabels: prometheus.Labels{"service": name},
-		},
-		[]string{"code", "method", "path", "channel"},
-	)
-	prometheus.MustRegister(m.reqs)
+	m := app.newPromotMiddleware(name, promMetricNames{
+		reqs:     patternReqsName,
+		latency:  patternLatencyName,
+		size:     patternSizeName,
+		inFlight: patternInFlightName,
+		suffix:   " (with patterns)",
+	}, buckets)
 
-	if len(buckets) == 0 {
-		buckets = dflBuckets
-	}
-	m.latency = prometheus.NewHistogramVec(prometheus.HistogramOpts{
-		Name:        patternLatencyName,
-		Help:        "How long it took to process the request, partitioned by status code, method and HTTP path (with patterns).",
-		ConstLabels: prometheus.Labels{"service": name},
-		Buckets:     buckets,
-	},
-		[]string{"code", "method", "path", "channel"},
-	)
-	prometheus.MustRegister(m.latency)
 	return m.patternHandler
 }
 
 func (c PromotMiddleware) patternHandler(next http.Handler) http.Handler {
 	fn := func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
+		c.inFlight.Inc()
+		defer c.inFlight.Dec()
+
+		r, outcome := withTimeoutOutcome(r)
 		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
 		next.ServeHTTP(ww, r)
 
-		rctx := chi.RouteContext(r.Context())
-		routePattern := strings.Join(rctx.RoutePatterns, "")
-		routePattern = strings.Replace(routePattern, "/*/", "/", -1)
-
-		// dt := time.Now().In(time.UTC).Format("2006-01-02 15:04:05")
-
-		c.reqs.WithLabelValues(http.StatusText(ww.Status()), r.Method, routePattern, r.Header.Get("X-CHANNEL")).Inc()
-		c.latency.WithLabelValues(http.StatusText(ww.Status()), r.Method, routePattern, r.Header.Get("X-CHANNEL")).Observe(float64(time.Since(start).Nanoseconds()) / 1000000)
+		c.observe(ww, r, routePattern(r), start, outcome)
 	}
 	return http.HandlerFunc(fn)
 }
+
+// observe record the finished request into every collector of the middleware,
+// the requests stopped by TimeoutMiddleware get the "Timeout" code
+func (c PromotMiddleware) observe(ww middleware.WrapResponseWriter, r *http.Request, path string, start time.Time, outcome *timeoutOutcome) {
+	status := http.StatusText(ww.Status())
+	if outcome.TimedOut() {
+		status = promTimeoutCode
+	}
+	channel := r.Header.Get(XChannelHeader)
+
+	c.reqs.WithLabelValues(status, r.Method, path, channel).Inc()
+	c.latency.WithLabelValues(status, r.Method, path, channel).Observe(float64(time.Since(start).Nanoseconds()) / 1000000)
+	c.size.WithLabelValues(status, r.Method, path, channel).Observe(float64(ww.BytesWritten()))
+}
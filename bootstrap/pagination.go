@@ -0,0 +1,233 @@
+package bootstrap
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"hypefast-api/lib/apperr"
+)
+
+const (
+	// PageParam the query param of the page number, starting at 1
+	PageParam = "page"
+
+	// LimitParam the query param of the page size
+	LimitParam = "limit"
+
+	// CursorParam the query param of the cursor of a keyset page
+	CursorParam = "cursor"
+
+	dflPageLimit = 20
+	dflMaxLimit  = 100
+	dflMaxOffset = 1000000
+)
+
+// PageRequest the page asked by the client
+type PageRequest struct {
+	Page   int
+	Limit  int
+	Cursor string
+}
+
+// Offset the number of rows before the page
+func (p PageRequest) Offset() int {
+	if p.Page <= 1 {
+		return 0
+	}
+
+	return (p.Page - 1) * p.Limit
+}
+
+// PaginationLinks the urls of the neighbour pages, also sent in the Link header
+type PaginationLinks struct {
+	Self  string `json:"self,omitempty"`
+	First string `json:"first,omitempty"`
+	Prev  string `json:"prev,omitempty"`
+	Next  string `json:"next,omitempty"`
+	Last  string `json:"last,omitempty"`
+}
+
+// Pagination the pagination of the response envelope.
+// An offset page has page, total and total_pages, a keyset page has the cursors.
+type Pagination struct {
+	Page       int             `json:"page,omitempty"`
+	PerPage    int             `json:"per_page"`
+	Total      *int64          `json:"total,omitempty"`
+	TotalPages *int            `json:"total_pages,omitempty"`
+	NextCursor string          `json:"next_cursor,omitempty"`
+	PrevCursor string          `json:"prev_cursor,omitempty"`
+	Links      PaginationLinks `json:"links"`
+}
+
+// GetPageRequest parse the page, limit and cursor query params.
+// The limit defaults to `pagination.default_limit` (20) and is capped at `pagination.max_limit` (100),
+// a page or limit that is not a positive integer, or a page past `pagination.max_offset` rows (1000000),
+// give an ERR:INVALID_PARAM error to send with SendError.
+func (h *App) GetPageRequest(r *http.Request) (PageRequest, error) {
+	dfl := h.Config.GetInt("pagination.default_limit")
+	if dfl <= 0 {
+		dfl = dflPageLimit
+	}
+	max := h.Config.GetInt("pagination.max_limit")
+	if max <= 0 {
+		max = dflMaxLimit
+	}
+
+	page, err := h.GetIntParam(r, PageParam)
+	if err != nil || page < 0 || (page == 0 && len(r.URL.Query().Get(PageParam)) > 0) {
+		return PageRequest{}, invalidParam(PageParam, "page must be a positive integer")
+	}
+	if page == 0 {
+		page = 1
+	}
+
+	limit, err := h.GetIntParam(r, LimitParam)
+	if err != nil || limit < 0 || (limit == 0 && len(r.URL.Query().Get(LimitParam)) > 0) {
+		return PageRequest{}, invalidParam(LimitParam, "limit must be a positive integer")
+	}
+	if limit == 0 {
+		limit = dfl
+	}
+	if limit > max {
+		limit = max
+	}
+
+	// a deep page would overflow the offset, and is slow to skip anyway
+	maxOffset := h.Config.GetInt("pagination.max_offset")
+	if maxOffset <= 0 {
+		maxOffset = dflMaxOffset
+	}
+	if page-1 > maxOffset/limit {
+		return PageRequest{}, invalidParam(PageParam, "page is too large")
+	}
+
+	cursor, _ := h.GetStringParam(r, CursorParam)
+
+	return PageRequest{Page: page, Limit: limit, Cursor: cursor}, nil
+}
+
+func invalidParam(param, message string) *apperr.Error {
+	return apperr.New(http.StatusBadRequest, MsgErrParam, "invalid_param", message).
+		WithDetails(map[string]string{"param": param})
+}
+
+// NewPagination the pagination of an offset page with the total number of rows
+func NewPagination(r *http.Request, page PageRequest, total int64) Pagination {
+	totalPages := 0
+	if page.Limit > 0 {
+		totalPages = int((total + int64(page.Limit) - 1) / int64(page.Limit))
+	}
+	p := Pagination{Page: page.Page, PerPage: page.Limit, Total: &total, TotalPages: &totalPages}
+
+	p.Links.Self = pageURL(r, page, PageParam, strconv.Itoa(page.Page))
+	p.Links.First = pageURL(r, page, PageParam, "1")
+	if page.Page > 1 {
+		// a page past the end go back to the last page
+		prev := page.Page - 1
+		if prev > totalPages && totalPages > 0 {
+			prev = totalPages
+		}
+		p.Links.Prev = pageURL(r, page, PageParam, strconv.Itoa(prev))
+	}
+	if page.Page < totalPages {
+		p.Links.Next = pageURL(r, page, PageParam, strconv.Itoa(page.Page+1))
+	}
+	if totalPages > 0 {
+		p.Links.Last = pageURL(r, page, PageParam, strconv.Itoa(totalPages))
+	}
+
+	return p
+}
+
+// NewCursorPagination the pagination of a keyset page, an empty cursor means there is no such page
+func NewCursorPagination(r *http.Request, page PageRequest, next, prev string) Pagination {
+	p := Pagination{PerPage: page.Limit, NextCursor: next, PrevCursor: prev}
+
+	p.Links.Self = pageURL(r, page, CursorParam, page.Cursor)
+	p.Links.First = pageURL(r, page, CursorParam, "")
+	if len(prev) > 0 {
+		p.Links.Prev = pageURL(r, page, CursorParam, prev)
+	}
+	if len(next) > 0 {
+		p.Links.Next = pageURL(r, page, CursorParam, next)
+	}
+
+	return p
+}
+
+// pageURL the url of the request with the param replaced, removed when value is empty,
+// and the limit of the client replaced with the one applied
+func pageURL(r *http.Request, page PageRequest, param, value string) string {
+	query := r.URL.Query()
+	if len(query.Get(LimitParam)) > 0 {
+		query.Set(LimitParam, strconv.Itoa(page.Limit))
+	}
+	if len(value) > 0 {
+		query.Set(param, value)
+	} else {
+		query.Del(param)
+	}
+
+	u := url.URL{Path: r.URL.Path, RawQuery: query.Encode()}
+
+	return u.String()
+}
+
+// SetLinkHeader set the RFC 5988 Link header of the pagination
+func SetLinkHeader(w http.ResponseWriter, p Pagination) {
+	var links []string
+	for _, l := range []struct{ rel, url string }{
+		{"first", p.Links.First},
+		{"prev", p.Links.Prev},
+		{"next", p.Links.Next},
+		{"last", p.Links.Last},
+	} {
+		if len(l.url) > 0 {
+			links = append(links, "<"+l.url+`>; rel="`+l.rel+`"`)
+		}
+	}
+
+	if len(links) > 0 {
+		w.Header().Set("Link", strings.Join(links, ", "))
+	}
+}
+
+// SendPaginated send success with the pagination in the envelope and the Link header
+//
+// Deprecated: use SendPaginatedR, which answer in the language of the request.
+func (h *App) SendPaginated(w http.ResponseWriter, payload interface{}, p Pagination) {
+	h.SendPaginatedR(w, nil, payload, p)
+}
+
+// SendPaginatedR send success with the pagination in the envelope and the Link header
+func (h *App) SendPaginatedR(w http.ResponseWriter, r *http.Request, payload interface{}, p Pagination) {
+	SetLinkHeader(w, p)
+	h.SendSuccessR(w, r, payload, p)
+}
+
+// EncodeCursor encode the keyset position of a row, e.g. its sort value and id, into an opaque cursor
+func EncodeCursor(position interface{}) (string, error) {
+	raw, err := json.Marshal(position)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+// DecodeCursor decode a cursor of EncodeCursor into position
+func DecodeCursor(cursor string, position interface{}) error {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err == nil {
+		err = json.Unmarshal(raw, position)
+	}
+	if err != nil {
+		return invalidParam(CursorParam, "invalid cursor")
+	}
+
+	return nil
+}
@@ -0,0 +1,61 @@
+package bootstrap
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"hypefast-api/lib/apperr"
+)
+
+func TestGetPageRequest(t *testing.T) {
+	app := newConfigApp(t, `{"pagination": {"max_limit": 50, "max_offset": 1000}}`)
+
+	tests := []struct {
+		query  string
+		want   PageRequest
+		offset int
+		// param the param of the ERR:INVALID_PARAM error
+		param string
+	}{
+		{query: "", want: PageRequest{Page: 1, Limit: 20}},
+		{query: "page=3&limit=10", want: PageRequest{Page: 3, Limit: 10}, offset: 20},
+		{query: "limit=500", want: PageRequest{Page: 1, Limit: 50}},
+		{query: "cursor=abc", want: PageRequest{Page: 1, Limit: 20, Cursor: "abc"}},
+		{query: "page=101&limit=10", want: PageRequest{Page: 101, Limit: 10}, offset: 1000},
+		{query: "page=102&limit=10", param: PageParam},
+		{query: "page=9223372036854775807", param: PageParam},
+		{query: "page=9223372036854775808", param: PageParam},
+		{query: "page=0", param: PageParam},
+		{query: "page=-1", param: PageParam},
+		{query: "page=x", param: PageParam},
+		{query: "limit=0", param: LimitParam},
+		{query: "limit=-5", param: LimitParam},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/v1/orders?"+tt.query, nil)
+		got, err := app.GetPageRequest(r)
+
+		if len(tt.param) > 0 {
+			var e *apperr.Error
+			if !errors.As(err, &e) || e.StatCode != MsgErrParam {
+				t.Errorf("GetPageRequest(%q) = %+v, %v, want an invalid %s", tt.query, got, err, tt.param)
+				continue
+			}
+			if details, _ := e.Details.(map[string]string); details["param"] != tt.param {
+				t.Errorf("GetPageRequest(%q) = %+v, %v, want an invalid %s", tt.query, got, err, tt.param)
+			}
+			continue
+		}
+
+		if err != nil || got != tt.want {
+			t.Errorf("GetPageRequest(%q) = %+v, %v, want %+v", tt.query, got, err, tt.want)
+			continue
+		}
+		if got.Offset() != tt.offset {
+			t.Errorf("GetPageRequest(%q).Offset() = %d, want %d", tt.query, got.Offset(), tt.offset)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package bootstrap
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"hypefast-api/lib/tracing"
+)
+
+const (
+	// ProblemContentType the media type of the RFC 7807 problem documents
+	ProblemContentType = "application/problem+json"
+
+	// problemCtxKey context key of the requests whose errors are problem documents,
+	// set by ProblemMiddleware and NegotiateProblemMiddleware
+	problemCtxKey = "problem"
+)
+
+// Problem a RFC 7807 problem document. The stat_code of the envelope, the apperr code and details,
+// the incident id and the trace id are extension members, errors hold the validation errors by field.
+type Problem struct {
+	Type       string              `json:"type"`
+	Title      string              `json:"title"`
+	Status     int                 `json:"status"`
+	Detail     string              `json:"detail,omitempty"`
+	Instance   string              `json:"instance,omitempty"`
+	StatCode   string              `json:"stat_code,omitempty"`
+	Code       string              `json:"code,omitempty"`
+	Errors     map[string][]string `json:"errors,omitempty"`
+	Details    interface{}         `json:"details,omitempty"`
+	IncidentID string              `json:"incident_id,omitempty"`
+	TraceID    string              `json:"trace_id,omitempty"`
+	Data       interface{}         `json:"data,omitempty"`
+}
+
+// ProblemMiddleware send the errors of the routes as RFC 7807 problem documents, for the route groups
+// of the clients that expect them. The success responses keep the envelope.
+func (app *App) ProblemMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r.WithContext(userContext(r.Context(), problemCtxKey, true)))
+	})
+}
+
+// NegotiateProblemMiddleware send the errors as RFC 7807 problem documents to the clients
+// that accept application/problem+json
+func (app *App) NegotiateProblemMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if acceptsProblem(r.Header.Get("Accept")) {
+			r = r.WithContext(userContext(r.Context(), problemCtxKey, true))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// wantsProblem the errors of the request are sent as problem documents
+func wantsProblem(r *http.Request) bool {
+	if r == nil {
+		return false
+	}
+
+	problem, _ := r.Context().Value(problemCtxKey).(bool)
+	return problem
+}
+
+// acceptsProblem the Accept header list application/problem+json with a quality above 0
+func acceptsProblem(accept string) bool {
+	for _, part := range strings.Split(accept, ",") {
+		fields := strings.Split(strings.TrimSpace(part), ";")
+		if !strings.EqualFold(strings.TrimSpace(fields[0]), ProblemContentType) {
+			continue
+		}
+
+		for _, f := range fields[1:] {
+			f = strings.TrimSpace(f)
+			if strings.HasPrefix(f, "q=") {
+				if v, err := strconv.ParseFloat(f[2:], 64); err == nil && v <= 0 {
+					return false
+				}
+			}
+		}
+
+		return true
+	}
+
+	return false
+}
+
+// problemType the type of the problems of the stat code: `problem.type_base` followed by the stat code
+// without its prefix, e.g. ERR:NOT_FOUND is <type_base>not-found, about:blank without type_base
+func (h *App) problemType(statCode string) string {
+	base := h.Config.GetString("problem.type_base")
+	if len(base) == 0 {
+		return "about:blank"
+	}
+
+	if i := strings.Index(statCode, ":"); i >= 0 {
+		statCode = statCode[i+1:]
+	}
+
+	return base + strings.ReplaceAll(strings.ToLower(statCode), "_", "-")
+}
+
+// newProblem the problem document of an error response of RespondWithJSON
+func (h *App) newProblem(w http.ResponseWriter, r *http.Request, httpCode int, statCode, message string, payload interface{}) Problem {
+	p := Problem{
+		Type:     h.problemType(statCode),
+		Title:    http.StatusText(httpCode),
+		Status:   httpCode,
+		Detail:   h.translateMessage(r, message),
+		Instance: r.URL.Path,
+		StatCode: statCode,
+		TraceID:  w.Header().Get(tracing.TraceIDHeader),
+	}
+
+	switch data := payload.(type) {
+	case errorData:
+		p.Code, p.Details, p.IncidentID = data.Code, data.Details, data.IncidentID
+	case map[string][]string:
+		p.Errors = data
+	default:
+		if v := reflect.ValueOf(payload); payload != nil && !(v.Kind() == reflect.Slice && v.Len() == 0) {
+			p.Data = payload
+		}
+	}
+
+	return p
+}
+
+// respondWithProblem write the problem document of an error response
+func (h *App) respondWithProblem(w http.ResponseWriter, r *http.Request, httpCode int, statCode, message string, payload interface{}) {
+	response, _ := json.Marshal(h.newProblem(w, r, httpCode, statCode, message, payload))
+
+	w.Header().Set("Content-Type", ProblemContentType)
+	w.WriteHeader(httpCode)
+	_, _ = w.Write(response)
+}
@@ -0,0 +1,226 @@
+package bootstrap
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"hypefast-api/lib/ratelimit"
+
+	"github.com/go-chi/chi"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// MsgTooManyRequests the client exceeded the rate limit
+	MsgTooManyRequests = "ERR:TOO_MANY_REQUESTS"
+
+	// rate limit keys
+	rateKeyIP      = "ip"
+	rateKeyMember  = "member"
+	rateKeyAPIKey  = "api_key"
+	rateKeyChannel = "channel"
+
+	// rateAnyPattern the pattern of the rule applied to the routes without their own rule
+	rateAnyPattern = "*"
+
+	dflAPIKeyHeader   = "X-API-KEY"
+	rateLimitPrefix   = "ratelimit:"
+	dflRateLimitLimit = 100
+	dflRateWindow     = time.Minute
+)
+
+// RateRule at most Limit requests per Window for each key of the rule
+type RateRule struct {
+	Name    string
+	Pattern string
+	Key     string
+	Limit   int
+	Window  time.Duration
+}
+
+// rateLimiter the limiter of `rate_limit.backend`: "redis" (default when App.Redis is set) or "memory"
+func (app *App) rateLimiter() ratelimit.Limiter {
+	if app.Config.GetString("rate_limit.backend") != "memory" && app.Redis != nil {
+		return ratelimit.NewRedis(app.Redis, rateLimitPrefix)
+	}
+
+	return ratelimit.NewMemory()
+}
+
+// rateRules read the rules of `rate_limit.rules`, one entry per rule name:
+//
+//	"rate_limit": {
+//	  "rules": {
+//	    "login": {"pattern": "/v1/auth/login", "key": "ip", "limit": 5, "window": "1m"},
+//	    "default": {"pattern": "*", "key": "ip", "limit": 300, "window": "1m"}
+//	  }
+//	}
+func (app *App) rateRules() map[string]RateRule {
+	names := app.Config.GetStringMapString("rate_limit.rules")
+
+	rules := make(map[string]RateRule, len(names))
+	for name := range names {
+		key := "rate_limit.rules." + name
+		rule := RateRule{
+			Name:    name,
+			Pattern: app.Config.GetString(key + ".pattern"),
+			Key:     app.Config.GetString(key + ".key"),
+			Limit:   app.Config.GetInt(key + ".limit"),
+			Window:  app.Config.GetDuration(key + ".window"),
+		}
+		if len(rule.Key) == 0 {
+			rule.Key = rateKeyIP
+		}
+		if rule.Limit <= 0 {
+			rule.Limit = dflRateLimitLimit
+		}
+		if rule.Window <= 0 {
+			rule.Window = dflRateWindow
+		}
+
+		rules[name] = rule
+	}
+
+	return rules
+}
+
+// RateLimitMiddleware limit the requests with the rules of their route pattern,
+// the routes without a rule use the rules of the "*" pattern when there are.
+// The route pattern is resolved before the routing, so it can be mounted on the root router.
+// The member rules are left to MemberRateLimitMiddleware, the member is not known before VerifyJwtToken.
+func (app *App) RateLimitMiddleware(next http.Handler) http.Handler {
+	return app.patternRateLimit(false, next)
+}
+
+// MemberRateLimitMiddleware limit the requests with the member rules of their route pattern (or of "*"),
+// to be mounted on the authenticated group after VerifyJwtToken.
+func (app *App) MemberRateLimitMiddleware(next http.Handler) http.Handler {
+	return app.patternRateLimit(true, next)
+}
+
+// patternRateLimit limit the requests with the rules by pattern, only the member rules or all the others.
+// Every rule of the pattern is applied, a pattern without a rule of the kind use the "*" rules of the kind.
+func (app *App) patternRateLimit(member bool, next http.Handler) http.Handler {
+	limiter := app.rateLimiter()
+	byPattern := map[string][]RateRule{}
+	for _, rule := range app.rateRules() {
+		if (rule.Key == rateKeyMember) != member {
+			continue
+		}
+		byPattern[rule.Pattern] = append(byPattern[rule.Pattern], rule)
+	}
+	for _, rules := range byPattern {
+		sort.Slice(rules, func(i, j int) bool { return rules[i].Name < rules[j].Name })
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rules, ok := byPattern[matchRoutePattern(r)]
+		if !ok {
+			rules = byPattern[rateAnyPattern]
+		}
+
+		app.limitAll(limiter, rules, next, w, r)
+	})
+}
+
+// limitAll limit the request with every rule, the first exceeded one answer 429
+func (app *App) limitAll(limiter ratelimit.Limiter, rules []RateRule, next http.Handler, w http.ResponseWriter, r *http.Request) {
+	if len(rules) == 0 {
+		next.ServeHTTP(w, r)
+		return
+	}
+
+	app.limit(limiter, rules[0], http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		app.limitAll(limiter, rules[1:], next, w, r)
+	}), w, r)
+}
+
+// RateLimit limit the requests with the named rule of `rate_limit.rules`, to be mounted on a route group.
+// Mount it after VerifyJwtToken to limit by member.
+func (app *App) RateLimit(name string) func(http.Handler) http.Handler {
+	limiter := app.rateLimiter()
+	rule, ok := app.rateRules()[name]
+	if !ok {
+		panic(fmt.Sprintf("rate_limit.rules.%s is not configured", name))
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			app.limit(limiter, rule, next, w, r)
+		})
+	}
+}
+
+func (app *App) limit(limiter ratelimit.Limiter, rule RateRule, next http.Handler, w http.ResponseWriter, r *http.Request) {
+	key := rule.Name + ":" + app.rateKey(rule.Key, r)
+
+	res, err := limiter.Allow(r.Context(), key, rule.Limit, rule.Window)
+	if err != nil {
+		// the limiter must not take the app down with it
+		app.Log.FromDefault().WithContext(r.Context()).WithFields(logrus.Fields{
+			"rule": rule.Name,
+		}).Errorf("rate limit: %v", err)
+		next.ServeHTTP(w, r)
+		return
+	}
+
+	h := w.Header()
+	h.Set("X-RateLimit-Limit", strconv.Itoa(res.Limit))
+	h.Set("X-RateLimit-Remaining", strconv.Itoa(res.Remaining))
+	h.Set("X-RateLimit-Reset", strconv.Itoa(ceilSeconds(res.Reset)))
+
+	if !res.Allowed {
+		h.Set("Retry-After", strconv.Itoa(ceilSeconds(res.RetryAfter)))
+		app.RespondWithJSONR(w, r, http.StatusTooManyRequests, MsgTooManyRequests, "too many requests, please try again later", app.EmptyJSONArr(), app.EmptyJSONArr())
+		return
+	}
+
+	next.ServeHTTP(w, r)
+}
+
+// rateKey the client of the request for the kind of key, fallback into the ip address
+func (app *App) rateKey(kind string, r *http.Request) string {
+	switch kind {
+	case rateKeyMember:
+		if mcode, ok := r.Context().Value("mcode").(string); ok && len(mcode) > 0 {
+			return "member:" + mcode
+		}
+	case rateKeyAPIKey:
+		header := app.Config.GetString("rate_limit.api_key_header")
+		if len(header) == 0 {
+			header = dflAPIKeyHeader
+		}
+		if v := r.Header.Get(header); len(v) > 0 {
+			return "api_key:" + v
+		}
+	case rateKeyChannel:
+		if v := app.GetChannel(r); len(v) > 0 {
+			return "channel:" + v
+		}
+	}
+
+	return "ip:" + clientIP(r)
+}
+
+// matchRoutePattern resolve the route pattern of the request before it is routed
+func matchRoutePattern(r *http.Request) string {
+	rctx := chi.RouteContext(r.Context())
+	if rctx == nil || rctx.Routes == nil {
+		return ""
+	}
+
+	tctx := chi.NewRouteContext()
+	if !rctx.Routes.Match(tctx, r.Method, r.URL.Path) {
+		return ""
+	}
+
+	return tctx.RoutePattern()
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
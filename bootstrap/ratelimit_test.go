@@ -0,0 +1,74 @@
+package bootstrap
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi"
+)
+
+const rateLimitConfig = `{
+  "rate_limit": {
+    "backend": "memory",
+    "rules": {
+      "login_ip": {"pattern": "/v1/auth/login", "key": "ip", "limit": 3, "window": "1m"},
+      "login_member": {"pattern": "/v1/auth/login", "key": "member", "limit": 1, "window": "1m"},
+      "orders_member": {"pattern": "/v1/orders", "key": "member", "limit": 5, "window": "1m"},
+      "default": {"pattern": "*", "key": "ip", "limit": 2, "window": "1m"}
+    }
+  }
+}`
+
+func TestRateLimitRulesOfOnePattern(t *testing.T) {
+	app := newConfigApp(t, rateLimitConfig)
+
+	r := chi.NewRouter()
+	r.Use(app.RateLimitMiddleware)
+	r.Group(func(r chi.Router) {
+		// the member VerifyJwtToken would set
+		r.Use(func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				mcode := r.Header.Get("X-Test-Member")
+				next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), "mcode", mcode)))
+			})
+		})
+		r.Use(app.MemberRateLimitMiddleware)
+
+		ok := func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusNoContent) }
+		r.Post("/v1/auth/login", ok)
+		r.Get("/v1/orders", ok)
+	})
+
+	send := func(method, path, member string) int {
+		req := httptest.NewRequest(method, path, nil)
+		req.RemoteAddr = "192.0.2.1:1234"
+		req.Header.Set("X-Test-Member", member)
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		member string
+		want   int
+	}{
+		{"login of a member", http.MethodPost, "/v1/auth/login", "m1", http.StatusNoContent},
+		{"the member rule", http.MethodPost, "/v1/auth/login", "m1", http.StatusTooManyRequests},
+		{"another member, same ip", http.MethodPost, "/v1/auth/login", "m2", http.StatusNoContent},
+		{"the ip rule", http.MethodPost, "/v1/auth/login", "m3", http.StatusTooManyRequests},
+		{"member only pattern use the * ip rule", http.MethodGet, "/v1/orders", "m1", http.StatusNoContent},
+		{"the * ip rule", http.MethodGet, "/v1/orders", "m1", http.StatusNoContent},
+		{"the * ip rule exceeded", http.MethodGet, "/v1/orders", "m1", http.StatusTooManyRequests},
+	}
+
+	for _, tt := range tests {
+		if got := send(tt.method, tt.path, tt.member); got != tt.want {
+			t.Errorf("%s: status = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,419 @@
+package bootstrap
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"path"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"hypefast-api/lib/apperr"
+	"hypefast-api/lib/render"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+const (
+	// MsgNotAcceptable none of the formats asked by the Accept header or the format param can be sent
+	MsgNotAcceptable = "ERR:NOT_ACCEPTABLE"
+
+	// FormatParam the query param choosing the format of the response, it wins over the Accept header
+	FormatParam = "format"
+
+	// FieldsParam the query param selecting the columns of a CSV or XLSX response, e.g. fields=id,name
+	FieldsParam = "fields"
+
+	// the formats of Render and RenderStream
+	FormatJSON    = "json"
+	FormatCSV     = "csv"
+	FormatXLSX    = "xlsx"
+	FormatMsgPack = "msgpack"
+
+	// streamFlushRows the rows sent between two flushes of RenderStream
+	streamFlushRows = 500
+)
+
+// formatContentTypes the Content-Type of each format
+var formatContentTypes = map[string]string{
+	FormatJSON:    "application/json",
+	FormatCSV:     "text/csv; charset=utf-8",
+	FormatXLSX:    "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+	FormatMsgPack: "application/msgpack",
+}
+
+// mediaFormats the format of the media types of the Accept header
+var mediaFormats = map[string]string{
+	"*/*":              FormatJSON,
+	"application/*":    FormatJSON,
+	"application/json": FormatJSON,
+	ProblemContentType: FormatJSON,
+	"text/*":           FormatCSV,
+	"text/csv":         FormatCSV,
+	"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet": FormatXLSX,
+	"application/msgpack":     FormatMsgPack,
+	"application/x-msgpack":   FormatMsgPack,
+	"application/vnd.msgpack": FormatMsgPack,
+}
+
+// RowStream produce the rows of RenderStream, emit is called once per row
+type RowStream func(emit func(row interface{}) error) error
+
+// streamFormats the formats of RenderStream. MessagePack is left out: an array starts with its length,
+// which a stream does not know before its last row.
+var streamFormats = map[string]string{
+	FormatJSON: formatContentTypes[FormatJSON],
+	FormatCSV:  formatContentTypes[FormatCSV],
+	FormatXLSX: formatContentTypes[FormatXLSX],
+}
+
+func notAcceptable(supported map[string]string) *apperr.Error {
+	formats := make([]string, 0, len(supported))
+	for f := range supported {
+		formats = append(formats, f)
+	}
+	sort.Strings(formats)
+
+	return apperr.New(http.StatusNotAcceptable, MsgNotAcceptable, "not_acceptable", "the requested format is not supported").
+		WithDetails(map[string]interface{}{"formats": formats})
+}
+
+// NegotiateFormat the format of the response: the format query param, else the media type of the
+// Accept header with the highest quality that can be sent, JSON when there is no Accept header.
+// The error is a 406 ERR:NOT_ACCEPTABLE apperr.Error.
+func NegotiateFormat(r *http.Request) (string, error) {
+	return negotiateFormat(r, formatContentTypes)
+}
+
+// negotiateFormat the format of the response among the supported formats, see NegotiateFormat
+func negotiateFormat(r *http.Request, supported map[string]string) (string, error) {
+	if format := strings.ToLower(r.URL.Query().Get(FormatParam)); len(format) > 0 {
+		if _, ok := supported[format]; !ok {
+			return "", notAcceptable(supported)
+		}
+		return format, nil
+	}
+
+	accept := r.Header.Get("Accept")
+	if len(strings.TrimSpace(accept)) == 0 {
+		return FormatJSON, nil
+	}
+
+	best, bestQ, bestExact := "", 0.0, false
+	for _, part := range strings.Split(accept, ",") {
+		fields := strings.Split(strings.TrimSpace(part), ";")
+		media := strings.ToLower(strings.TrimSpace(fields[0]))
+
+		q := 1.0
+		for _, f := range fields[1:] {
+			f = strings.TrimSpace(f)
+			if strings.HasPrefix(f, "q=") {
+				if v, err := strconv.ParseFloat(f[2:], 64); err == nil {
+					q = v
+				}
+			}
+		}
+
+		format, ok := mediaFormats[media]
+		if _, supported := supported[format]; !ok || !supported || q <= 0 {
+			continue
+		}
+
+		// an exact media type wins a tie over a wildcard
+		exact := !strings.HasSuffix(media, "*")
+		if q > bestQ || (q == bestQ && exact && !bestExact) {
+			best, bestQ, bestExact = format, q, exact
+		}
+	}
+
+	if len(best) == 0 {
+		return "", notAcceptable(supported)
+	}
+
+	return best, nil
+}
+
+// Render send the payload in the format of NegotiateFormat. JSON and MessagePack hold the envelope of
+// SendSuccess, CSV and XLSX are a table of the rows (the payload must be a struct or a slice of structs)
+// with the columns of exportColumns. The Link header is set when the pagination is a Pagination.
+func (h *App) Render(w http.ResponseWriter, r *http.Request, payload interface{}, pagination interface{}) {
+	format, err := NegotiateFormat(r)
+	if err != nil {
+		h.SendError(w, r, err)
+		return
+	}
+
+	w.Header().Add("Vary", "Accept")
+	if p, ok := pagination.(Pagination); ok {
+		SetLinkHeader(w, p)
+	}
+	if pagination == nil {
+		pagination = h.EmptyJSONArr()
+	}
+
+	switch format {
+	case FormatJSON:
+		h.SendSuccessR(w, r, payload, pagination)
+	case FormatMsgPack:
+		var buf bytes.Buffer
+		if err := newMsgPackEncoder(&buf).Encode(h.envelope(w, r, MsgSuccess, "Success", payload, pagination)); err != nil {
+			h.SendError(w, r, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", formatContentTypes[FormatMsgPack])
+		_, _ = w.Write(buf.Bytes())
+	default:
+		h.streamRows(w, r, format, payload, func(emit func(row interface{}) error) error {
+			return emit(payload)
+		})
+	}
+}
+
+// RenderStream send the rows of stream in the format of NegotiateFormat without holding them in memory:
+// JSON is the envelope of SendSuccess with the rows in data, CSV and XLSX a table with the columns of
+// exportColumns, row is a value of the rows type to take them from. The rows are flushed to the client
+// every 500 rows. MessagePack is not supported (406), see streamFormats.
+//
+// When stream fails before the first row the error is sent with SendError,
+// after it the response is already started: the error is logged and the response aborted.
+func (h *App) RenderStream(w http.ResponseWriter, r *http.Request, row interface{}, stream RowStream) {
+	format, err := negotiateFormat(r, streamFormats)
+	if err != nil {
+		h.SendError(w, r, err)
+		return
+	}
+
+	w.Header().Add("Vary", "Accept")
+	h.streamRows(w, r, format, row, stream)
+}
+
+func (h *App) streamRows(w http.ResponseWriter, r *http.Request, format string, row interface{}, stream RowStream) {
+	var enc rowEncoder
+	switch format {
+	case FormatCSV, FormatXLSX:
+		t, err := render.RowType(row)
+		if err != nil {
+			h.SendError(w, r, notAcceptable(streamFormats))
+			return
+		}
+
+		cols, err := exportColumns(r, t)
+		if err != nil {
+			h.SendError(w, r, err)
+			return
+		}
+
+		enc = &tableEncoder{w: w, format: format, name: exportName(r), rowType: t, cols: cols}
+	default:
+		enc = &jsonEncoder{w: w, r: r, h: h}
+	}
+
+	started, rows := false, 0
+	start := func() error {
+		started = true
+		w.Header().Set("Content-Type", formatContentTypes[format])
+		return enc.begin()
+	}
+
+	err := stream(func(row interface{}) error {
+		if !started {
+			if err := start(); err != nil {
+				return err
+			}
+		}
+
+		if err := enc.row(row); err != nil {
+			return err
+		}
+
+		if rows++; rows%streamFlushRows == 0 {
+			return enc.flush()
+		}
+
+		return nil
+	})
+
+	if err == nil && !started {
+		err = start()
+	}
+	if err == nil {
+		err = enc.end()
+	}
+
+	switch {
+	case err == nil:
+	case !started:
+		h.SendError(w, r, err)
+	default:
+		h.Log.FromDefault().WithContext(r.Context()).Errorf("render %s %s as %s: %v", r.Method, r.URL.Path, format, err)
+		panic(http.ErrAbortHandler)
+	}
+}
+
+// exportColumns the columns of the rows type, the ones of the fields query param when it is given
+func exportColumns(r *http.Request, t reflect.Type) ([]render.Column, error) {
+	var selected []string
+	if fields := r.URL.Query().Get(FieldsParam); len(fields) > 0 {
+		selected = strings.Split(fields, ",")
+	}
+
+	cols, err := render.Columns(t, selected)
+	if err != nil {
+		return nil, invalidParam(FieldsParam, "fields must be fields of the data")
+	}
+
+	return cols, nil
+}
+
+// exportName the file name of an export without extension, the last segment of the path
+func exportName(r *http.Request) string {
+	name := strings.Map(func(c rune) rune {
+		if (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') || c == '-' || c == '_' {
+			return c
+		}
+		return -1
+	}, path.Base(r.URL.Path))
+
+	if len(name) == 0 {
+		name = "export"
+	}
+
+	return name
+}
+
+func newMsgPackEncoder(w *bytes.Buffer) *msgpack.Encoder {
+	enc := msgpack.NewEncoder(w)
+	enc.SetCustomStructTag("json")
+	enc.SetSortMapKeys(true)
+
+	return enc
+}
+
+// rowEncoder write the rows of streamRows in a format
+type rowEncoder interface {
+	begin() error
+	row(v interface{}) error
+	flush() error
+	end() error
+}
+
+// flushResponse send what was written to the client when the response writer can
+func flushResponse(w http.ResponseWriter) {
+	if f, ok := w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// jsonEncoder write the envelope of SendSuccess with the rows in data
+type jsonEncoder struct {
+	w    http.ResponseWriter
+	r    *http.Request
+	h    *App
+	bw   *bufio.Writer
+	rows int
+}
+
+func (e *jsonEncoder) begin() error {
+	env := e.h.envelope(e.w, e.r, MsgSuccess, "Success", nil, e.h.EmptyJSONArr())
+	delete(env, "data")
+
+	head, err := json.Marshal(env)
+	if err != nil {
+		return err
+	}
+
+	e.bw = bufio.NewWriter(e.w)
+	e.bw.Write(head[:len(head)-1])
+	_, err = e.bw.WriteString(`,"data":[`)
+
+	return err
+}
+
+func (e *jsonEncoder) row(v interface{}) error {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	if e.rows > 0 {
+		e.bw.WriteByte(',')
+	}
+	e.rows++
+	_, err = e.bw.Write(raw)
+
+	return err
+}
+
+func (e *jsonEncoder) flush() error {
+	if err := e.bw.Flush(); err != nil {
+		return err
+	}
+	flushResponse(e.w)
+
+	return nil
+}
+
+func (e *jsonEncoder) end() error {
+	if _, err := e.bw.WriteString("]}"); err != nil {
+		return err
+	}
+
+	return e.bw.Flush()
+}
+
+// tableEncoder write the rows as a CSV or XLSX file download
+type tableEncoder struct {
+	w       http.ResponseWriter
+	format  string
+	name    string
+	rowType reflect.Type
+	cols    []render.Column
+	table   render.TableWriter
+}
+
+func (e *tableEncoder) begin() error {
+	e.w.Header().Set("Content-Disposition", `attachment; filename="`+e.name+"."+e.format+`"`)
+
+	if e.format == FormatXLSX {
+		x, err := render.NewXLSXWriter(e.w, e.name)
+		if err != nil {
+			return err
+		}
+		e.table = x
+	} else {
+		e.table = render.NewCSVWriter(e.w)
+	}
+
+	return e.table.WriteHeader(render.Headers(e.cols))
+}
+
+// row write the row, a slice of rows is written row by row
+func (e *tableEncoder) row(v interface{}) error {
+	return render.EachRow(v, func(row reflect.Value) error {
+		if row.Type() != e.rowType {
+			return errors.New("render: the row is a " + row.Type().String() + ", not a " + e.rowType.String())
+		}
+
+		return e.table.WriteRow(render.Values(e.cols, row))
+	})
+}
+
+func (e *tableEncoder) flush() error {
+	if f, ok := e.table.(interface{ Flush() error }); ok {
+		if err := f.Flush(); err != nil {
+			return err
+		}
+	}
+	flushResponse(e.w)
+
+	return nil
+}
+
+func (e *tableEncoder) end() error {
+	return e.table.Close()
+}
@@ -0,0 +1,90 @@
+package bootstrap
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"hypefast-api/lib/apperr"
+)
+
+func TestNegotiateFormat(t *testing.T) {
+	tests := []struct {
+		name   string
+		query  string
+		accept string
+		want   string
+		// stream the formats of RenderStream
+		stream bool
+	}{
+		{name: "no accept", want: FormatJSON},
+		{name: "any", accept: "*/*", want: FormatJSON},
+		{name: "json", accept: "application/json", want: FormatJSON},
+		{name: "problem json", accept: "application/problem+json", want: FormatJSON},
+		{name: "csv", accept: "text/csv", want: FormatCSV},
+		{name: "text wildcard", accept: "text/*", want: FormatCSV},
+		{name: "xlsx", accept: "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", want: FormatXLSX},
+		{name: "msgpack", accept: "application/x-msgpack", want: FormatMsgPack},
+		{name: "highest quality", accept: "application/json;q=0.5, text/csv;q=0.9", want: FormatCSV},
+		{name: "exact type wins a tie", accept: "*/*, text/csv", want: FormatCSV},
+		{name: "parameters and case", accept: "Text/CSV; charset=utf-8", want: FormatCSV},
+		{name: "q=0 is refused", accept: "text/csv;q=0, application/json", want: FormatJSON},
+		{name: "unknown types are skipped", accept: "image/png, text/csv;q=0.1", want: FormatCSV},
+		{name: "nothing acceptable", accept: "image/png"},
+		{name: "only q=0", accept: "text/csv;q=0"},
+		{name: "format param wins", query: "format=xlsx", accept: "application/json", want: FormatXLSX},
+		{name: "format param is case insensitive", query: "format=CSV", want: FormatCSV},
+		{name: "unknown format param", query: "format=pdf"},
+		{name: "stream json", accept: "application/json", want: FormatJSON, stream: true},
+		{name: "stream skip msgpack", accept: "application/msgpack, text/csv;q=0.5", want: FormatCSV, stream: true},
+		{name: "stream msgpack only", accept: "application/msgpack", stream: true},
+		{name: "stream msgpack param", query: "format=msgpack", stream: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/v1/orders?"+tt.query, nil)
+			if len(tt.accept) > 0 {
+				r.Header.Set("Accept", tt.accept)
+			}
+
+			var (
+				got string
+				err error
+			)
+			if tt.stream {
+				got, err = negotiateFormat(r, streamFormats)
+			} else {
+				got, err = NegotiateFormat(r)
+			}
+
+			if len(tt.want) == 0 {
+				var e *apperr.Error
+				if !errors.As(err, &e) || e.Status != http.StatusNotAcceptable || e.StatCode != MsgNotAcceptable {
+					t.Fatalf("format = %q, error = %v, want 406 %s", got, err, MsgNotAcceptable)
+				}
+				return
+			}
+
+			if err != nil || got != tt.want {
+				t.Errorf("format = %q, error = %v, want %q", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestNotAcceptableListsTheSupportedFormats(t *testing.T) {
+	details, _ := notAcceptable(streamFormats).Details.(map[string]interface{})
+	formats, _ := details["formats"].([]string)
+
+	want := []string{FormatCSV, FormatJSON, FormatXLSX}
+	if len(formats) != len(want) {
+		t.Fatalf("formats = %v, want %v", formats, want)
+	}
+	for i := range want {
+		if formats[i] != want[i] {
+			t.Fatalf("formats = %v, want %v", formats, want)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package bootstrap
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"hypefast-api/lib/signature"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// XClientID custom header to hold the client that signed the request
+	XClientID = signature.HeaderClientID
+
+	// XNonce custom header to hold the one time value of a signed request
+	XNonce = signature.HeaderNonce
+
+	dflSignatureWindow = 5 * time.Minute
+	nonceKeyPrefix     = "sig:nonce:"
+
+	// clientCtxKey context key of the client verified by SignatureMiddleware
+	clientCtxKey = "client_id"
+)
+
+// SignatureMiddleware verify the HMAC-SHA256 signature of the request.
+//
+// The client sends X-CLIENT-ID, X-TIMESTAMPT (unix seconds), X-NONCE and X-SIGNATURE,
+// the signature is computed over the method, path, canonical query, body hash, timestamp
+// and nonce (see signature.Canonical) with the secret of `signature.clients.<client id>`.
+// The timestamp must be within `signature.window` (default 5m) of the server time
+// and a nonce is only accepted once within the window, it is tracked by nonceStore.
+// The client ids of the config are lowercased by viper, the X-CLIENT-ID header is matched
+// case insensitively and the verified client (lowercased) is put into the request context.
+func (app *App) SignatureMiddleware(next http.Handler) http.Handler {
+	secrets := app.Config.GetStringMapString("signature.clients")
+	nonces := app.nonceStore()
+	window := app.Config.GetDuration("signature.window")
+	if window <= 0 {
+		window = dflSignatureWindow
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		clientID := strings.ToLower(r.Header.Get(XClientID))
+		secret, ok := secrets[clientID]
+		if len(clientID) == 0 || !ok {
+			app.SendAuthErrorR(w, r, "unknown client")
+			return
+		}
+
+		ts, err := strconv.ParseInt(r.Header.Get(XTimestamp), 10, 64)
+		if err != nil {
+			app.SendAuthErrorR(w, r, "invalid timestamp")
+			return
+		}
+
+		skew := time.Since(time.Unix(ts, 0))
+		if skew > window || skew < -window {
+			app.SendAuthErrorR(w, r, "expired signature")
+			return
+		}
+
+		nonce := r.Header.Get(XNonce)
+		if len(nonce) == 0 {
+			app.SendAuthErrorR(w, r, "undefined nonce")
+			return
+		}
+
+		body, err := signature.ReadBody(r)
+		if err != nil {
+			app.SendBindErrorR(w, r, err)
+			return
+		}
+
+		canonical := signature.Canonical(r.Method, r.URL.EscapedPath(), r.URL.Query(),
+			signature.BodyHash(body), r.Header.Get(XTimestamp), nonce)
+		if !signature.Verify(secret, canonical, r.Header.Get(XSignature)) {
+			app.SendAuthErrorR(w, r, "invalid signature")
+			return
+		}
+
+		// the nonce is kept for both sides of the window, after that the timestamp is rejected anyway
+		fresh, err := nonces.Use(r.Context(), clientID+":"+nonce, 2*window)
+		if err != nil {
+			app.Log.FromDefault().WithContext(r.Context()).WithFields(logrus.Fields{
+				"client": clientID,
+			}).Errorf("signature nonce: %v", err)
+			app.RespondWithJSONR(w, r, http.StatusServiceUnavailable, MsgUnavailable, "cannot verify the request", app.EmptyJSONArr(), app.EmptyJSONArr())
+			return
+		}
+
+		if !fresh {
+			app.SendAuthErrorR(w, r, "replayed request")
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(userContext(r.Context(), clientCtxKey, clientID)))
+	})
+}
+
+// nonceStore the nonce store of `signature.backend`: "redis" (default when App.Redis is set) or "memory".
+// The memory store only sees the nonces of this instance, it is meant for a single instance and the test runs.
+func (app *App) nonceStore() signature.NonceStore {
+	if app.Config.GetString("signature.backend") != "memory" && app.Redis != nil {
+		return signature.NewRedisNonceStore(app.Redis, nonceKeyPrefix)
+	}
+
+	if app.Config.GetString("signature.backend") != "memory" {
+		app.Log.FromDefault().Warn("signature: redis is not configured, the nonces are tracked in memory")
+	}
+
+	return signature.NewMemoryNonceStore()
+}
@@ -0,0 +1,333 @@
+package bootstrap
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	// MsgTimeout the request took longer than the timeout of its route
+	MsgTimeout = "ERR:TIMEOUT"
+
+	// XRequestTimeout the time budget left of the caller in milliseconds,
+	// set by DeadlineTransport and honoured by TimeoutMiddleware
+	XRequestTimeout = "X-Request-Timeout"
+
+	// promTimeoutCode the code label of the requests that timed out
+	promTimeoutCode = "Timeout"
+
+	timeoutOutcomeCtxKey = "timeout_outcome"
+)
+
+// timeoutOutcome shared by the metrics middleware and TimeoutMiddleware
+// so the timed out requests get their own code label
+type timeoutOutcome struct {
+	timedOut int32
+}
+
+func withTimeoutOutcome(r *http.Request) (*http.Request, *timeoutOutcome) {
+	outcome := &timeoutOutcome{}
+	return r.WithContext(context.WithValue(r.Context(), timeoutOutcomeCtxKey, outcome)), outcome
+}
+
+func (o *timeoutOutcome) TimedOut() bool {
+	return o != nil && atomic.LoadInt32(&o.timedOut) == 1
+}
+
+// timeoutRules the timeout by route pattern of `timeout.routes`, one entry per rule name:
+//
+//	"timeout": {
+//	  "default": "30s",
+//	  "routes": {
+//	    "report": {"pattern": "/v1/api/report", "timeout": "2m"}
+//	  }
+//	}
+func (app *App) timeoutRules() map[string]time.Duration {
+	names := app.Config.GetStringMapString("timeout.routes")
+
+	rules := make(map[string]time.Duration, len(names))
+	for name := range names {
+		key := "timeout.routes." + name
+		if d := app.Config.GetDuration(key + ".timeout"); d > 0 {
+			rules[app.Config.GetString(key+".pattern")] = d
+		}
+	}
+
+	return rules
+}
+
+// CheckTimeouts fail when `timeout.default` or the timeout of a route is not shorter than the write
+// timeout of the server, the connection would be closed before the 504 is sent
+func (app *App) CheckTimeouts(writeTimeout time.Duration) error {
+	if writeTimeout <= 0 {
+		return nil
+	}
+
+	if d := app.Config.GetDuration("timeout.default"); d >= writeTimeout {
+		return fmt.Errorf("timeout.default %s must be shorter than server.write_timeout %s", d, writeTimeout)
+	}
+
+	rules := app.timeoutRules()
+	patterns := make([]string, 0, len(rules))
+	for pattern := range rules {
+		patterns = append(patterns, pattern)
+	}
+	sort.Strings(patterns)
+
+	for _, pattern := range patterns {
+		if d := rules[pattern]; d >= writeTimeout {
+			return fmt.Errorf("the timeout %s of %s must be shorter than server.write_timeout %s", d, pattern, writeTimeout)
+		}
+	}
+
+	return nil
+}
+
+// TimeoutMiddleware set the deadline of the request context to the timeout of the route pattern
+// (`timeout.routes`), or `timeout.default` for the other routes. A caller budget given by
+// the X-Request-Timeout header shorten it. pgx, go-redis and the outgoing requests made with
+// the request context stop at the deadline; when it fires the client get 504 (or
+// `timeout.status_code`) and whatever the handler writes afterward is dropped. A handler that
+// flushed is streaming: its response is already sent, on timeout the connection is aborted.
+func (app *App) TimeoutMiddleware(next http.Handler) http.Handler {
+	dfl := app.Config.GetDuration("timeout.default")
+	rules := app.timeoutRules()
+
+	status := http.StatusGatewayTimeout
+	if code := app.Config.GetInt("timeout.status_code"); code == http.StatusServiceUnavailable {
+		status = code
+	}
+
+	panics := app.panicCounter()
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		timeout, ok := rules[matchRoutePattern(r)]
+		if !ok {
+			timeout = dfl
+		}
+
+		if budget, err := strconv.ParseInt(r.Header.Get(XRequestTimeout), 10, 64); err == nil && budget > 0 {
+			if d := time.Duration(budget) * time.Millisecond; timeout <= 0 || d < timeout {
+				timeout = d
+			}
+		}
+
+		if timeout <= 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+		r = r.WithContext(ctx)
+
+		// the handler see the headers set by the previous middlewares
+		tw := &timeoutWriter{w: w, h: w.Header().Clone()}
+		done := make(chan struct{})
+		panicChan := make(chan interface{}, 1)
+
+		go func() {
+			defer func() {
+				if p := recover(); p != nil {
+					if p != http.ErrAbortHandler {
+						// the stack of the calling goroutine would not show where it happened
+						p = handlerPanic{value: p, stack: debug.Stack()}
+					}
+
+					tw.mu.Lock()
+					defer tw.mu.Unlock()
+					if !tw.timedOut {
+						panicChan <- p
+						return
+					}
+					// nobody waits for the handler anymore
+					app.reportLatePanic(panics, r, p)
+				}
+			}()
+			next.ServeHTTP(tw, r)
+			close(done)
+		}()
+
+		select {
+		case p := <-panicChan:
+			// let the Recoverer of the calling goroutine handle it
+			panic(p)
+		case <-done:
+			tw.mu.Lock()
+			defer tw.mu.Unlock()
+
+			if !tw.streaming {
+				tw.sendLocked()
+			}
+		case <-ctx.Done():
+			tw.mu.Lock()
+			defer tw.mu.Unlock()
+
+			tw.timedOut = true
+			select {
+			case p := <-panicChan:
+				// the handler panicked as the deadline fired
+				app.reportLatePanic(panics, r, p)
+			default:
+			}
+			if ctx.Err() != context.DeadlineExceeded {
+				// the client went away
+				return
+			}
+
+			if outcome, ok := r.Context().Value(timeoutOutcomeCtxKey).(*timeoutOutcome); ok {
+				atomic.StoreInt32(&outcome.timedOut, 1)
+			}
+
+			app.Log.FromDefault().WithContext(r.Context()).Warnf("request %s %s timed out after %s", r.Method, r.URL.Path, timeout)
+			if tw.streaming {
+				// the status is already sent, abort so the client see the response is cut
+				panic(http.ErrAbortHandler)
+			}
+			app.RespondWithJSONR(w, r, status, MsgTimeout, app.T(r, "the request took longer than %s", timeout), app.EmptyJSONArr(), app.EmptyJSONArr())
+		}
+	})
+}
+
+// reportLatePanic log and count a panic of the handler that happened once the request timed out,
+// the Recoverer of the calling goroutine does not see it
+func (app *App) reportLatePanic(panics *prometheus.CounterVec, r *http.Request, p interface{}) {
+	if hp, ok := p.(handlerPanic); ok {
+		app.reportPanic(panics, r, hp.value, hp.stack)
+	}
+}
+
+// handlerPanic a panic of the handler run by TimeoutMiddleware with the stack of its goroutine,
+// the Recoverer logs the value and this stack
+type handlerPanic struct {
+	value interface{}
+	stack []byte
+}
+
+func (p handlerPanic) String() string {
+	return fmt.Sprint(p.value)
+}
+
+// timeoutWriter buffer the response of the handler until it finish in time,
+// once flushed the response is streaming and the writes go straight to w
+type timeoutWriter struct {
+	w http.ResponseWriter
+	h http.Header
+
+	mu          sync.Mutex
+	buf         bytes.Buffer
+	code        int
+	wroteHeader bool
+	timedOut    bool
+	streaming   bool
+}
+
+func (tw *timeoutWriter) Header() http.Header { return tw.h }
+
+func (tw *timeoutWriter) Write(p []byte) (int, error) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+
+	if tw.timedOut {
+		return 0, http.ErrHandlerTimeout
+	}
+
+	if !tw.wroteHeader {
+		tw.writeHeaderLocked(http.StatusOK)
+	}
+	if tw.streaming {
+		return tw.w.Write(p)
+	}
+
+	return tw.buf.Write(p)
+}
+
+// Flush implement http.Flusher, the headers and the buffered body are sent and the response is streaming
+func (tw *timeoutWriter) Flush() {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+
+	if tw.timedOut {
+		return
+	}
+
+	if !tw.streaming {
+		tw.sendLocked()
+		tw.streaming = true
+	}
+
+	if f, ok := tw.w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// sendLocked send the headers and the buffered body to w
+func (tw *timeoutWriter) sendLocked() {
+	dst := tw.w.Header()
+	for k, v := range tw.h {
+		dst[k] = v
+	}
+	if !tw.wroteHeader {
+		tw.code = http.StatusOK
+	}
+
+	tw.w.WriteHeader(tw.code)
+	_, _ = tw.w.Write(tw.buf.Bytes())
+	tw.buf.Reset()
+}
+
+func (tw *timeoutWriter) WriteHeader(code int) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+
+	if tw.timedOut {
+		return
+	}
+
+	tw.writeHeaderLocked(code)
+}
+
+func (tw *timeoutWriter) writeHeaderLocked(code int) {
+	if tw.wroteHeader {
+		return
+	}
+
+	tw.wroteHeader = true
+	tw.code = code
+}
+
+// DeadlineTransport pass the time left before the deadline of the request context
+// in the X-Request-Timeout header, so the called service stop at the same time.
+type DeadlineTransport struct {
+	Base http.RoundTripper
+}
+
+// RoundTrip implement http.RoundTripper
+func (t DeadlineTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	if deadline, ok := req.Context().Deadline(); ok {
+		left := time.Until(deadline).Milliseconds()
+		if left <= 0 {
+			return nil, context.DeadlineExceeded
+		}
+
+		req = req.Clone(req.Context())
+		req.Header.Set(XRequestTimeout, strconv.FormatInt(left, 10))
+	}
+
+	return base.RoundTrip(req)
+}
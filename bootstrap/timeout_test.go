@@ -0,0 +1,64 @@
+package bootstrap
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"hypefast-api/lib/i18n"
+	"hypefast-api/lib/logger"
+)
+
+func TestTimeoutReportsThePanicAfterTheDeadline(t *testing.T) {
+	app := newConfigApp(t, `{"timeout": {"default": "20ms"}}`)
+	app.Log = logger.New("file", filepath.Join(t.TempDir(), "log"))
+	app.I18n = i18n.New("en")
+
+	panicked := make(chan struct{})
+	handler := app.TimeoutMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer close(panicked)
+		<-r.Context().Done()
+		panic("the query was cancelled")
+	}))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/orders", nil))
+
+	if rec.Code != http.StatusGatewayTimeout {
+		t.Fatalf("status = %d, want 504", rec.Code)
+	}
+
+	<-panicked
+	// the panic is reported by the recover of the handler goroutine
+	deadline := time.Now().Add(time.Second)
+	for panicCount(t, app) != 1 {
+		if time.Now().After(deadline) {
+			t.Fatalf("%s = %v, want 1", panicsName, panicCount(t, app))
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// panicCount the sum of http_panics_total
+func panicCount(t *testing.T, app *App) float64 {
+	t.Helper()
+
+	families, err := app.registry().Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var total float64
+	for _, family := range families {
+		if family.GetName() != panicsName {
+			continue
+		}
+		for _, m := range family.GetMetric() {
+			total += m.GetCounter().GetValue()
+		}
+	}
+
+	return total
+}
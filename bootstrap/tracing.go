@@ -0,0 +1,103 @@
+package bootstrap
+
+import (
+	"fmt"
+	"net/http"
+
+	"hypefast-api/lib/tracing"
+	"hypefast-api/lib/utils"
+
+	"github.com/go-chi/chi"
+	"github.com/go-chi/chi/middleware"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// SetupTracing create the tracer provider from the `tracing` config,
+// it returns nil when tracing is disabled.
+func SetupTracing(config utils.Config) (*tracing.Provider, error) {
+	if !config.GetBool("tracing.enabled") {
+		return nil, nil
+	}
+
+	name := config.GetString("tracing.service_name")
+	if len(name) == 0 {
+		name = config.GetString("app.name")
+	}
+
+	return tracing.New(tracing.Options{
+		ServiceName:    name,
+		ServiceVersion: config.GetString("app.version"),
+		Exporter:       config.GetString("tracing.exporter"),
+		Endpoint:       config.GetString("tracing.endpoint"),
+		Headers:        config.GetStringMapString("tracing.headers"),
+		File:           config.GetString("tracing.file"),
+		SampleRatio:    config.GetFloat64("tracing.sample_ratio"),
+	})
+}
+
+// InstrumentTracing hook the tracing into App.DB, App.Redis, App.RedisCache and the logger
+func (app *App) InstrumentTracing() {
+	if app.DB != nil {
+		app.DB.AddHook(tracing.QueryHook{})
+	}
+	if app.Redis != nil {
+		app.Redis.AddHook(tracing.RedisHook{Client: "default"})
+	}
+	if app.RedisCache != nil {
+		app.RedisCache.AddHook(tracing.RedisHook{Client: "cache"})
+	}
+	if app.Log != nil {
+		app.Log.FromDefault().AddHook(tracing.LogHook{})
+	}
+}
+
+// TracingMiddleware start a server span for every request, named by the chi route pattern.
+// The trace context of the caller is continued and the trace id is returned in the X-Trace-Id header.
+func (app *App) TracingMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := tracing.Extract(r.Context(), r.Header)
+		ctx, span := tracing.Tracer().Start(ctx, fmt.Sprintf("HTTP %s", r.Method),
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				semconv.HTTPMethod(r.Method),
+				semconv.HTTPTarget(r.URL.Path),
+				semconv.UserAgentOriginal(r.UserAgent()),
+			),
+		)
+		defer span.End()
+
+		if traceID := tracing.TraceID(ctx); len(traceID) > 0 {
+			w.Header().Set(tracing.TraceIDHeader, traceID)
+		}
+
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(ww, r.WithContext(ctx))
+
+		if pattern := routePattern(r); len(pattern) > 0 {
+			span.SetName(fmt.Sprintf("%s %s", r.Method, pattern))
+			span.SetAttributes(semconv.HTTPRoute(pattern))
+		}
+
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+		span.SetAttributes(semconv.HTTPStatusCode(status))
+		if status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(status))
+		}
+	})
+}
+
+// routePattern give the matched chi route pattern of the request,
+// e.g. /v1/users/{code} instead of /v1/users/u-abc
+func routePattern(r *http.Request) string {
+	rctx := chi.RouteContext(r.Context())
+	if rctx == nil {
+		return ""
+	}
+
+	return rctx.RoutePattern()
+}
@@ -0,0 +1,214 @@
+package bootstrap
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+	"sync"
+
+	"hypefast-api/lib/validation"
+
+	ut "github.com/go-playground/universal-translator"
+	validator "github.com/go-playground/validator/v10"
+	"github.com/jackc/pgx/v4"
+)
+
+// domainRule a custom validation tag with its en and id messages, {0} is the field and {1} the param
+type domainRule struct {
+	tag string
+	fn  validator.Func
+	en  string
+	id  string
+}
+
+// domainRules the validators of the Indonesian business data
+var domainRules = []domainRule{
+	{"id_phone", stringRule(validation.IsIDMobile), "{0} must be an Indonesian mobile phone number", "{0} harus berupa nomor ponsel Indonesia"},
+	{"nik", stringRule(validation.IsNIK), "{0} must be a valid NIK", "{0} harus berupa NIK yang valid"},
+	{"npwp", stringRule(validation.IsNPWP), "{0} must be a valid NPWP", "{0} harus berupa NPWP yang valid"},
+	{"kodepos", stringRule(validation.IsKodePos), "{0} must be a valid postal code", "{0} harus berupa kode pos yang valid"},
+	{"user_code", stringRule(validation.IsUserCode), "{0} must be a valid user code", "{0} harus berupa kode user yang valid"},
+	{"idr", isIDR, "{0} must be a whole rupiah amount", "{0} harus berupa nominal rupiah tanpa desimal"},
+}
+
+// the translations missing from the validator id translations
+var idExtraTranslations = map[string]string{
+	"e164": "{0} harus berupa nomor telepon format E.164",
+}
+
+const (
+	uniqueDBTag = "unique_db"
+	uniqueDBEN  = "{0} is already used"
+	uniqueDBID  = "{0} sudah digunakan"
+)
+
+func stringRule(fn func(string) bool) validator.Func {
+	return func(fl validator.FieldLevel) bool {
+		if fl.Field().Kind() != reflect.String {
+			return false
+		}
+
+		return fn(fl.Field().String())
+	}
+}
+
+// isIDR a non negative amount without fraction: an integer, a float without decimals or a string of digits
+func isIDR(fl validator.FieldLevel) bool {
+	field := fl.Field()
+
+	switch field.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return field.Int() >= 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return true
+	case reflect.Float32, reflect.Float64:
+		f := field.Float()
+		return f >= 0 && f == math.Trunc(f)
+	case reflect.String:
+		return validation.IsIDRString(field.String())
+	}
+
+	return false
+}
+
+// registerDomainRules register the validators of the Indonesian business data with their translations
+func registerDomainRules(driver *validator.Validate, transEN, transID ut.Translator) {
+	for _, rule := range domainRules {
+		_ = driver.RegisterValidation(rule.tag, rule.fn)
+		registerMessage(driver, transEN, rule.tag, rule.en)
+		registerMessage(driver, transID, rule.tag, rule.id)
+	}
+
+	for tag, msg := range idExtraTranslations {
+		registerMessage(driver, transID, tag, msg)
+	}
+}
+
+// registerMessage register the message of the tag for the translator
+func registerMessage(driver *validator.Validate, trans ut.Translator, tag, msg string) {
+	_ = driver.RegisterTranslation(tag, trans,
+		func(ut ut.Translator) error {
+			return ut.Add(tag, msg, true)
+		},
+		func(ut ut.Translator, fe validator.FieldError) string {
+			t, err := ut.T(fe.Tag(), fe.Field(), fe.Param())
+			if err != nil {
+				return fe.Error()
+			}
+			return t
+		})
+}
+
+// RegisterStorageValidators register the validators that query App.DB, to be called once the DB is connected:
+//
+//	unique_db=users.email
+//	unique_db=users.email:ID
+//	unique_db=users.email:user_code=Code
+//
+// fails when a row of the table has the value in the column. After ":" is the field of the struct
+// holding the key of the row being updated, that row is not counted; the key column is id unless
+// given before "=". The tables and columns come from the tags, never from the request.
+// A malformed tag fails the validation and is logged. Validate with StructCtx (BindAndValidate does)
+// so the query gets the request context.
+func (app *App) RegisterStorageValidators() {
+	if app.DB == nil || app.Validator == nil {
+		return
+	}
+
+	_ = app.Validator.Driver.RegisterValidationCtx(uniqueDBTag, app.isUniqueInDB)
+
+	for lang, msg := range map[string]string{"en": uniqueDBEN, "id": uniqueDBID} {
+		if trans, found := app.Validator.Uni.GetTranslator(lang); found {
+			registerMessage(app.Validator.Driver, trans, uniqueDBTag, msg)
+		}
+	}
+}
+
+// uniqueDBSpec the parsed param of a unique_db tag
+type uniqueDBSpec struct {
+	sql string
+	// keyField the struct field of the key of the row to exclude, empty without exclusion
+	keyField string
+	// excludeSQL the query that does not count the row of $2
+	excludeSQL string
+}
+
+// uniqueDBSpecs the specs by tag param, parsed at their first use
+var uniqueDBSpecs sync.Map
+
+// parseUniqueDB parse table.column[:[key_column=]KeyField]
+func parseUniqueDB(param string) (uniqueDBSpec, error) {
+	if v, ok := uniqueDBSpecs.Load(param); ok {
+		return v.(uniqueDBSpec), nil
+	}
+
+	target, exclude := param, ""
+	if i := strings.IndexByte(param, ':'); i >= 0 {
+		target, exclude = param[:i], param[i+1:]
+	}
+
+	parts := strings.Split(target, ".")
+	if len(parts) != 2 || len(parts[0]) == 0 || len(parts[1]) == 0 {
+		return uniqueDBSpec{}, fmt.Errorf("%s wants table.column[:[key_column=]KeyField], got %q", uniqueDBTag, param)
+	}
+
+	table := pgx.Identifier{parts[0]}.Sanitize()
+	column := pgx.Identifier{parts[1]}.Sanitize()
+	spec := uniqueDBSpec{sql: "SELECT EXISTS (SELECT 1 FROM " + table + " WHERE " + column + " = $1)"}
+
+	if i := strings.IndexByte(param, ':'); i >= 0 {
+		keyColumn, keyField := "id", exclude
+		if j := strings.IndexByte(exclude, '='); j >= 0 {
+			keyColumn, keyField = exclude[:j], exclude[j+1:]
+		}
+		if len(keyColumn) == 0 || len(keyField) == 0 {
+			return uniqueDBSpec{}, fmt.Errorf("%s wants table.column[:[key_column=]KeyField], got %q", uniqueDBTag, param)
+		}
+
+		spec.keyField = keyField
+		spec.excludeSQL = "SELECT EXISTS (SELECT 1 FROM " + table + " WHERE " + column + " = $1 AND " +
+			pgx.Identifier{keyColumn}.Sanitize() + " <> $2)"
+	}
+
+	uniqueDBSpecs.Store(param, spec)
+
+	return spec, nil
+}
+
+func (app *App) isUniqueInDB(ctx context.Context, fl validator.FieldLevel) bool {
+	spec, err := parseUniqueDB(fl.Param())
+	if err != nil {
+		app.Log.FromDefault().WithContext(ctx).Errorf("validator: %v", err)
+		return false
+	}
+
+	sql, args := spec.sql, []interface{}{fl.Field().Interface()}
+	if len(spec.keyField) > 0 {
+		parent := reflect.Indirect(fl.Parent())
+		key := reflect.Value{}
+		if parent.Kind() == reflect.Struct {
+			key = parent.FieldByName(spec.keyField)
+		}
+		if !key.IsValid() {
+			app.Log.FromDefault().WithContext(ctx).Errorf("validator: %s %s: %s has no field %s",
+				uniqueDBTag, fl.Param(), parent.Type(), spec.keyField)
+			return false
+		}
+
+		// a zero key is a new row, there is nothing to exclude
+		if !key.IsZero() {
+			sql, args = spec.excludeSQL, append(args, key.Interface())
+		}
+	}
+
+	var exists bool
+	if err := app.DB.QueryRowNamed(ctx, "validator."+uniqueDBTag, sql, args...).Scan(&exists); err != nil {
+		// a storage error is not a validation error, the unique constraint of the table still holds
+		app.Log.FromDefault().WithContext(ctx).Errorf("validator %s %s: %v", uniqueDBTag, fl.Param(), err)
+		return true
+	}
+
+	return !exists
+}
@@ -3,8 +3,10 @@ module hypefast-api
 go 1.15
 
 require (
-	cloud.google.com/go/firestore v1.1.0
+	cloud.google.com/go/firestore v1.11.0
 	firebase.google.com/go v3.13.0+incompatible
+	github.com/alicebob/miniredis/v2 v2.17.0
+	github.com/andybalholm/brotli v1.0.4
 	github.com/aws/aws-sdk-go v1.38.65
 	github.com/certifi/gocertifi v0.0.0-20210507211836-431795d63e8d // indirect
 	github.com/dgrijalva/jwt-go v3.2.0+incompatible
@@ -17,18 +19,24 @@ require (
 	github.com/go-playground/locales v0.13.0
 	github.com/go-playground/universal-translator v0.17.0
 	github.com/go-playground/validator/v10 v10.6.1
-	github.com/go-redis/redis/v8 v8.10.0
-	github.com/go-sql-driver/mysql v1.6.0
+	github.com/go-redis/redis/v8 v8.11.5
+	github.com/jackc/pgconn v1.8.1
 	github.com/jackc/pgx/v4 v4.11.0
-	github.com/jmoiron/sqlx v1.3.4
+	github.com/lib/pq v1.8.0 // indirect
 	github.com/prometheus/client_golang v1.11.0
 	github.com/sirupsen/logrus v1.8.1
 	github.com/spf13/viper v1.8.0
-	github.com/twpayne/go-geom v1.3.6
 	github.com/urfave/cli/v2 v2.3.0
-	go.mongodb.org/mongo-driver v1.5.3
-	golang.org/x/net v0.0.0-20210614182718-04defd469f4e
-	golang.org/x/oauth2 v0.0.0-20210402161424-2e8d93401602
-	google.golang.org/api v0.44.0
+	github.com/vmihailenco/msgpack/v5 v5.3.5
+	go.opentelemetry.io/otel v1.19.0
+	go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp v1.19.0
+	go.opentelemetry.io/otel/exporters/stdout/stdouttrace v1.19.0
+	go.opentelemetry.io/otel/sdk v1.19.0
+	go.opentelemetry.io/otel/trace v1.19.0
+	golang.org/x/net v0.12.0
+	golang.org/x/oauth2 v0.10.0
+	golang.org/x/sync v0.3.0
+	golang.org/x/sys v0.13.0
+	google.golang.org/api v0.126.0
 	gopkg.in/Iwark/spreadsheet.v2 v2.0.0-20191122095212-08231195c43b
 )
@@ -0,0 +1,237 @@
+package apperr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+)
+
+// the stat_code of the response envelope
+const (
+	StatBadRequest      = "ERR:BAD_REQUEST"
+	StatValidation      = "ERR:VALIDATION"
+	StatUnauthenticated = "ERR:AUTHENTICATION"
+	StatForbidden       = "ERR:AUTHORIZED"
+	StatNotFound        = "ERR:NOT_FOUND"
+	StatConflict        = "ERR:CONFLICT"
+	StatUnprocessable   = "ERR:UNPROCESSABLE"
+	StatTooManyRequests = "ERR:TOO_MANY_REQUESTS"
+	StatInternal        = "ERR:INTERNAL"
+	StatUnavailable     = "ERR:SERVICE_UNAVAILABLE"
+	StatTimeout         = "ERR:TIMEOUT"
+)
+
+// postgres error codes
+const (
+	pgUniqueViolation     = "23505"
+	pgForeignKeyViolation = "23503"
+	pgNotNullViolation    = "23502"
+	pgCheckViolation      = "23514"
+)
+
+// Error an application error that knows its response
+type Error struct {
+	// Code the specific error, e.g. "user.email_taken"
+	Code string
+	// Status the HTTP status code
+	Status int
+	// StatCode the stat_code of the envelope, e.g. ERR:CONFLICT
+	StatCode string
+	// MessageKey the key of the message translation
+	MessageKey string
+	// Message the default message, shown when there is no translation
+	Message string
+	// Details shown to the client, e.g. the invalid fields
+	Details interface{}
+	// Cause the underlying error, logged but never shown to the client
+	Cause error
+}
+
+// New create an application error
+func New(status int, statCode, code, message string) *Error {
+	return &Error{Status: status, StatCode: statCode, Code: code, MessageKey: code, Message: message}
+}
+
+// Error implement error
+func (e *Error) Error() string {
+	if e.Cause != nil {
+		return fmt.Sprintf("%s: %s: %v", e.StatCode, e.Message, e.Cause)
+	}
+
+	return e.StatCode + ": " + e.Message
+}
+
+// Unwrap give the cause to errors.Is and errors.As
+func (e *Error) Unwrap() error {
+	return e.Cause
+}
+
+// Is match the errors of the same code, so a predefined error can be compared with errors.Is
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Code == e.Code && t.StatCode == e.StatCode
+}
+
+// Wrap copy the error with its cause
+func (e *Error) Wrap(cause error) *Error {
+	c := *e
+	c.Cause = cause
+
+	return &c
+}
+
+// WithDetails copy the error with the details for the client
+func (e *Error) WithDetails(details interface{}) *Error {
+	c := *e
+	c.Details = details
+
+	return &c
+}
+
+// WithMessage copy the error with another message and message key
+func (e *Error) WithMessage(key, message string) *Error {
+	c := *e
+	c.MessageKey = key
+	c.Message = message
+
+	return &c
+}
+
+// BadRequest the request is malformed, 400
+func BadRequest(code, message string) *Error {
+	return New(http.StatusBadRequest, StatBadRequest, code, message)
+}
+
+// Unauthenticated the client is not authenticated, 401
+func Unauthenticated(code, message string) *Error {
+	return New(http.StatusUnauthorized, StatUnauthenticated, code, message)
+}
+
+// Forbidden the client is not allowed to do it, 403 with the ERR:AUTHORIZED stat code
+func Forbidden(code, message string) *Error {
+	return New(http.StatusForbidden, StatForbidden, code, message)
+}
+
+// NotFound the resource does not exist, 404
+func NotFound(code, message string) *Error {
+	return New(http.StatusNotFound, StatNotFound, code, message)
+}
+
+// Conflict the request conflict with the current state of the resource, 409
+func Conflict(code, message string) *Error {
+	return New(http.StatusConflict, StatConflict, code, message)
+}
+
+// Unprocessable the request is well formed but cannot be processed, 422
+func Unprocessable(code, message string) *Error {
+	return New(http.StatusUnprocessableEntity, StatUnprocessable, code, message)
+}
+
+// TooManyRequests the client is over its rate limit, 429
+func TooManyRequests(code, message string) *Error {
+	return New(http.StatusTooManyRequests, StatTooManyRequests, code, message)
+}
+
+// Internal an unexpected server error, 500
+func Internal(cause error) *Error {
+	return New(http.StatusInternalServerError, StatInternal, "internal", "Something error with our system. Please contact our administrator with the incident id").Wrap(cause)
+}
+
+// Unavailable a dependency is down, 503
+func Unavailable(code, message string) *Error {
+	return New(http.StatusServiceUnavailable, StatUnavailable, code, message)
+}
+
+// the errors mapped from the storage and the context
+var (
+	ErrNotFound   = NotFound("not_found", "data not found")
+	ErrDuplicate  = Conflict("duplicate", "data already exists")
+	ErrReferenced = Conflict("referenced", "data is referenced by other data")
+	ErrInvalid    = Unprocessable("invalid", "data is not valid")
+	ErrTimeout    = New(http.StatusGatewayTimeout, StatTimeout, "timeout", "the request took too long")
+	// ErrCanceled is only logged, the client went away
+	ErrCanceled = New(499, StatBadRequest, "canceled", "the request was canceled")
+)
+
+var (
+	constraintsMu sync.RWMutex
+	constraints   = map[string]string{}
+)
+
+// RegisterConstraint give the public field name of a database constraint,
+// sent in the details of its violation, e.g. RegisterConstraint("users_email_key", "email")
+func RegisterConstraint(constraint, field string) {
+	constraintsMu.Lock()
+	defer constraintsMu.Unlock()
+
+	constraints[constraint] = field
+}
+
+// withField the error with the field of the constraint in its details, unchanged for an unknown constraint
+func withField(e *Error, constraint string) *Error {
+	constraintsMu.RLock()
+	field, ok := constraints[constraint]
+	constraintsMu.RUnlock()
+
+	if !ok {
+		return e
+	}
+
+	return e.WithDetails(map[string]string{"field": field})
+}
+
+// As find the application error in the chain of err
+func As(err error) (*Error, bool) {
+	var e *Error
+	if errors.As(err, &e) {
+		return e, true
+	}
+
+	return nil, false
+}
+
+// From map any error to an application error:
+// pgx.ErrNoRows give 404, a unique or foreign key violation 409, a not null or check violation 422,
+// a context deadline 504, and any other error is an internal error wrapping it.
+// The constraint and column names stay in the cause, the client only get the field
+// of a constraint registered with RegisterConstraint.
+func From(err error) *Error {
+	if err == nil {
+		return nil
+	}
+
+	if e, ok := As(err); ok {
+		return e
+	}
+
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrNotFound.Wrap(err)
+	}
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		switch pgErr.Code {
+		case pgUniqueViolation:
+			return withField(ErrDuplicate, pgErr.ConstraintName).Wrap(err)
+		case pgForeignKeyViolation:
+			return withField(ErrReferenced, pgErr.ConstraintName).Wrap(err)
+		case pgNotNullViolation, pgCheckViolation:
+			return withField(ErrInvalid, pgErr.ConstraintName).Wrap(err)
+		}
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) {
+		return ErrTimeout.Wrap(err)
+	}
+
+	if errors.Is(err, context.Canceled) {
+		return ErrCanceled.Wrap(err)
+	}
+
+	return Internal(err)
+}
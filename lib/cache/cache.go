@@ -0,0 +1,253 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"golang.org/x/sync/singleflight"
+)
+
+const (
+	tagPrefix = "tag:"
+
+	// dflRefreshRatio the part of the ttl left when Remember refresh the value in the background
+	dflRefreshRatio = 0.1
+
+	// loadTimeout how long a shared load or a background refresh may take
+	loadTimeout = 30 * time.Second
+)
+
+// setWithTags store the value and add its key to the tag sets,
+// a tag set lives at least as long as the keys it holds
+var setWithTags = redis.NewScript(`
+local ttl = tonumber(ARGV[2])
+redis.call('SET', KEYS[1], ARGV[1], 'PX', ttl)
+for i = 2, #KEYS do
+	redis.call('SADD', KEYS[i], KEYS[1])
+	if redis.call('PTTL', KEYS[i]) < ttl then
+		redis.call('PEXPIRE', KEYS[i], ttl)
+	end
+end
+return 1
+`)
+
+// Loader load the value of a missing key
+type Loader func(ctx context.Context) (interface{}, error)
+
+// Hook observe the cache lookups, for the hit/miss ratio
+type Hook interface {
+	Observe(ctx context.Context, key string, hit bool)
+}
+
+// entry the stored value with its expiry, used by the early refresh
+type entry struct {
+	Value     json.RawMessage `json:"v"`
+	ExpiresAt int64           `json:"e"`
+	TTL       int64           `json:"t"`
+}
+
+// Cache a JSON cache on a redis client
+type Cache struct {
+	client       *redis.Client
+	prefix       string
+	refreshRatio float64
+	hooks        []Hook
+	flight       singleflight.Group
+	refreshing   sync.Map
+}
+
+// New create the cache, every key is stored under prefix
+func New(client *redis.Client, prefix string) *Cache {
+	return &Cache{client: client, prefix: prefix, refreshRatio: dflRefreshRatio}
+}
+
+// SetRefreshRatio set the part of the ttl left when Remember refresh the value, 0 disable the early refresh
+func (c *Cache) SetRefreshRatio(ratio float64) {
+	c.refreshRatio = ratio
+}
+
+// AddHook add a lookup observer
+func (c *Cache) AddHook(h Hook) {
+	c.hooks = append(c.hooks, h)
+}
+
+// Get decode the value of key into dest, false when the key is missing
+func (c *Cache) Get(ctx context.Context, key string, dest interface{}) (bool, error) {
+	e, ok, err := c.get(ctx, key)
+	if err != nil || !ok {
+		return false, err
+	}
+
+	return true, json.Unmarshal(e.Value, dest)
+}
+
+// Set store the value of key for ttl, the key is invalidated with any of the tags
+func (c *Cache) Set(ctx context.Context, key string, value interface{}, ttl time.Duration, tags ...string) error {
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+
+	return c.set(ctx, key, raw, ttl, tags)
+}
+
+// Delete remove the keys
+func (c *Cache) Delete(ctx context.Context, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+
+	full := make([]string, 0, len(keys))
+	for _, k := range keys {
+		full = append(full, c.prefix+k)
+	}
+
+	return c.client.Del(ctx, full...).Err()
+}
+
+// Invalidate remove every key stored with one of the tags
+func (c *Cache) Invalidate(ctx context.Context, tags ...string) error {
+	for _, tag := range tags {
+		tagKey := c.prefix + tagPrefix + tag
+
+		keys, err := c.client.SMembers(ctx, tagKey).Result()
+		if err != nil {
+			return err
+		}
+
+		if err := c.client.Del(ctx, append(keys, tagKey)...).Err(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Remember decode the value of key into dest, loading and storing it with fn when it is missing.
+// Concurrent misses of a key share one load, and a value close to its expiry
+// is refreshed in the background while the current one is still served.
+// The shared load runs with the values of ctx but its own timeout, a caller whose ctx ends stops waiting for it
+// without cancelling it for the others.
+func (c *Cache) Remember(ctx context.Context, key string, ttl time.Duration, dest interface{}, fn Loader, tags ...string) error {
+	e, ok, err := c.get(ctx, key)
+	if err != nil {
+		// serve from the source when the cache is down
+		log.Printf("[cache] get %s: %v", key, err)
+	}
+
+	if ok {
+		if c.needRefresh(e) {
+			if _, running := c.refreshing.LoadOrStore(key, struct{}{}); !running {
+				go c.refresh(ctx, key, ttl, fn, tags)
+			}
+		}
+
+		return json.Unmarshal(e.Value, dest)
+	}
+
+	ch := c.flight.DoChan(key, func() (interface{}, error) {
+		return c.load(ctx, key, ttl, fn, tags)
+	})
+
+	select {
+	case res := <-ch:
+		if res.Err != nil {
+			return res.Err
+		}
+		return json.Unmarshal(res.Val.([]byte), dest)
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (c *Cache) refresh(ctx context.Context, key string, ttl time.Duration, fn Loader, tags []string) {
+	defer c.refreshing.Delete(key)
+
+	_, err, _ := c.flight.Do(key, func() (interface{}, error) {
+		return c.load(ctx, key, ttl, fn, tags)
+	})
+	if err != nil {
+		log.Printf("[cache] refresh %s: %v", key, err)
+	}
+}
+
+// load the value with fn and store it, in a context detached from the caller
+func (c *Cache) load(ctx context.Context, key string, ttl time.Duration, fn Loader, tags []string) ([]byte, error) {
+	ctx, cancel := detach(ctx, loadTimeout)
+	defer cancel()
+
+	value, err := fn(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := c.set(ctx, key, raw, ttl, tags); err != nil {
+		log.Printf("[cache] set %s: %v", key, err)
+	}
+
+	return raw, nil
+}
+
+func (c *Cache) needRefresh(e entry) bool {
+	if c.refreshRatio <= 0 || e.TTL <= 0 {
+		return false
+	}
+
+	left := time.Until(time.Unix(0, e.ExpiresAt))
+	return float64(left) < float64(e.TTL)*c.refreshRatio
+}
+
+func (c *Cache) get(ctx context.Context, key string) (entry, bool, error) {
+	var e entry
+
+	raw, err := c.client.Get(ctx, c.prefix+key).Bytes()
+	if err == redis.Nil {
+		c.observe(ctx, key, false)
+		return e, false, nil
+	}
+	if err != nil {
+		return e, false, err
+	}
+
+	if err := json.Unmarshal(raw, &e); err != nil {
+		c.observe(ctx, key, false)
+		return e, false, nil
+	}
+
+	c.observe(ctx, key, true)
+	return e, true, nil
+}
+
+func (c *Cache) set(ctx context.Context, key string, raw []byte, ttl time.Duration, tags []string) error {
+	e, err := json.Marshal(entry{
+		Value:     raw,
+		ExpiresAt: time.Now().Add(ttl).UnixNano(),
+		TTL:       int64(ttl),
+	})
+	if err != nil {
+		return err
+	}
+
+	keys := make([]string, 0, len(tags)+1)
+	keys = append(keys, c.prefix+key)
+	for _, tag := range tags {
+		keys = append(keys, c.prefix+tagPrefix+tag)
+	}
+
+	return setWithTags.Run(ctx, c.client, keys, e, ttl.Milliseconds()).Err()
+}
+
+func (c *Cache) observe(ctx context.Context, key string, hit bool) {
+	for _, h := range c.hooks {
+		h.Observe(ctx, key, hit)
+	}
+}
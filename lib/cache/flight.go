@@ -0,0 +1,25 @@
+package cache
+
+import (
+	"context"
+	"time"
+)
+
+// detachedContext keep the values of its parent (trace, logger) but not its deadline nor its cancellation,
+// so a shared load is not stopped by the caller that started it going away
+type detachedContext struct {
+	parent context.Context
+}
+
+func (detachedContext) Deadline() (time.Time, bool) { return time.Time{}, false }
+func (detachedContext) Done() <-chan struct{}       { return nil }
+func (detachedContext) Err() error                  { return nil }
+
+func (d detachedContext) Value(key interface{}) interface{} {
+	return d.parent.Value(key)
+}
+
+// detach the context of a shared load, it gets its own timeout
+func detach(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(detachedContext{parent: ctx}, timeout)
+}
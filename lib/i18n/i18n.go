@@ -0,0 +1,146 @@
+package i18n
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Catalog the messages by language and key, a missing message falls back
+// to the message of the fallback language and then to the key itself
+type Catalog struct {
+	fallback string
+
+	mu       sync.RWMutex
+	messages map[string]map[string]string
+}
+
+// New create an empty catalog
+func New(fallback string) *Catalog {
+	return &Catalog{fallback: Normalize(fallback), messages: map[string]map[string]string{}}
+}
+
+// Fallback the language used when the client accept none of the catalog
+func (c *Catalog) Fallback() string {
+	if c == nil {
+		return ""
+	}
+
+	return c.fallback
+}
+
+// Add add or replace the messages of a language
+func (c *Catalog) Add(lang string, messages map[string]string) {
+	lang = Normalize(lang)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	m, ok := c.messages[lang]
+	if !ok {
+		m = make(map[string]string, len(messages))
+		c.messages[lang] = m
+	}
+	for k, v := range messages {
+		m[k] = v
+	}
+}
+
+// Languages the languages of the catalog, sorted
+func (c *Catalog) Languages() []string {
+	if c == nil {
+		return nil
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	langs := make([]string, 0, len(c.messages))
+	for lang := range c.messages {
+		langs = append(langs, lang)
+	}
+	sort.Strings(langs)
+
+	return langs
+}
+
+// Lookup the message of the key in the language only
+func (c *Catalog) Lookup(lang, key string) (string, bool) {
+	if c == nil {
+		return "", false
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	msg, ok := c.messages[Normalize(lang)][key]
+	return msg, ok
+}
+
+// Translate the message of the key in the language, formatted with args when there are any
+func (c *Catalog) Translate(lang, key string, args ...interface{}) string {
+	msg, ok := c.Lookup(lang, key)
+	if !ok {
+		if msg, ok = c.Lookup(c.Fallback(), key); !ok {
+			msg = key
+		}
+	}
+
+	if len(args) > 0 {
+		return fmt.Sprintf(msg, args...)
+	}
+
+	return msg
+}
+
+// Negotiate the language of supported with the highest quality in the Accept-Language header,
+// a region is matched on its primary language (id-ID give id). Empty when none is acceptable.
+func Negotiate(acceptLanguage string, supported []string) string {
+	best, bestQ := "", 0.0
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		fields := strings.Split(strings.TrimSpace(part), ";")
+		tag := Normalize(fields[0])
+		if len(tag) == 0 {
+			continue
+		}
+
+		q := 1.0
+		for _, f := range fields[1:] {
+			f = strings.TrimSpace(f)
+			if strings.HasPrefix(f, "q=") {
+				if v, err := strconv.ParseFloat(f[2:], 64); err == nil {
+					q = v
+				}
+			}
+		}
+		if q <= bestQ {
+			continue
+		}
+
+		for _, lang := range supported {
+			if tag == "*" || tag == lang {
+				best, bestQ = lang, q
+				break
+			}
+		}
+	}
+
+	return best
+}
+
+// Normalize the primary language of a tag in lower case, e.g. "id-ID" give "id".
+// "in" is the legacy tag of Indonesian still sent by old Android clients.
+func Normalize(tag string) string {
+	tag = strings.ToLower(strings.TrimSpace(tag))
+	if i := strings.IndexAny(tag, "-_"); i >= 0 {
+		tag = tag[:i]
+	}
+
+	if tag == "in" {
+		return "id"
+	}
+
+	return tag
+}
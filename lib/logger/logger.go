@@ -2,6 +2,7 @@ package logger
 
 import (
 	"os"
+	"sync"
 	"time"
 
 	"github.com/evalphobia/logrus_sentry"
@@ -13,6 +14,7 @@ type Contract interface {
 	Sentry() *logrus.Logger
 	File() *logrus.Logger
 	FromDefault() *logrus.Logger
+	Close() error
 }
 
 // logs ...
@@ -20,6 +22,11 @@ type logs struct {
 	Logrus      *logrus.Logger
 	DefaultType string
 	Source      string
+
+	fileOnce   sync.Once
+	file       *os.File
+	sentryOnce sync.Once
+	sentry     *logrus_sentry.SentryHook
 }
 
 // New instantiate the logger package
@@ -31,7 +38,7 @@ func New(tp, source string) Contract {
 	}
 }
 
-func (th logs) FromDefault() *logrus.Logger {
+func (th *logs) FromDefault() *logrus.Logger {
 	var log *logrus.Logger
 	switch def := th.DefaultType; def {
 	case "file":
@@ -44,55 +51,58 @@ func (th logs) FromDefault() *logrus.Logger {
 	return log
 }
 
-// File is a function to set logrus with file
-func (th logs) File() *logrus.Logger {
-	var (
-		err  error
-		file *os.File
-	)
-	path := th.Source
-	// if file exist then open and append/write into log file.
-	if _, err = os.Stat(path); err == nil {
-		file, err = os.OpenFile(path, os.O_APPEND|os.O_WRONLY, os.ModeAppend)
-		if err == nil {
-			th.Logrus.Out = file
-
-			return th.Logrus
+// File is a function to set logrus with file.
+// The file is opened once and kept open until Close.
+func (th *logs) File() *logrus.Logger {
+	th.fileOnce.Do(func() {
+		// if file exist then open and append/write into log file.
+		file, err := os.OpenFile(th.Source, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+		if err != nil {
+			th.Logrus.Info("Failed to log to file, using default stderr")
+			return
 		}
-	}
 
-	file, err = os.OpenFile(path, os.O_CREATE|os.O_WRONLY, 0755)
-	if err == nil {
+		th.file = file
 		th.Logrus.Out = file
-	} else {
-		th.Logrus.Info("Failed to log to file, using default stderr")
-	}
-
-	defer file.Close()
+	})
 
 	return th.Logrus
 }
 
-// Sentry is a function for setting Sentry.io logger
-func (th logs) Sentry() *logrus.Logger {
-	var (
-		err  error
-		hook *logrus_sentry.SentryHook
-	)
-	hook, err = logrus_sentry.NewAsyncSentryHook(th.Source, []logrus.Level{
-		logrus.PanicLevel,
-		logrus.FatalLevel,
-		logrus.ErrorLevel,
-		logrus.DebugLevel,
-		logrus.InfoLevel,
-		logrus.WarnLevel,
+// Sentry is a function for setting Sentry.io logger.
+// The hook is added once and flushed on Close.
+func (th *logs) Sentry() *logrus.Logger {
+	th.sentryOnce.Do(func() {
+		hook, err := logrus_sentry.NewAsyncSentryHook(th.Source, []logrus.Level{
+			logrus.PanicLevel,
+			logrus.FatalLevel,
+			logrus.ErrorLevel,
+			logrus.DebugLevel,
+			logrus.InfoLevel,
+			logrus.WarnLevel,
+		})
+		if err != nil {
+			return
+		}
+
+		hook.Timeout = 10 * time.Second
+		th.sentry = hook
+		th.Logrus.Hooks.Add(hook)
 	})
 
-	hook.Timeout = 10 * time.Second
+	return th.Logrus
+}
 
-	if err == nil {
-		th.Logrus.Hooks.Add(hook)
+// Close flush the pending sentry events and close the log file
+func (th *logs) Close() error {
+	if th.sentry != nil {
+		th.sentry.Flush()
 	}
 
-	return th.Logrus
+	if th.file != nil {
+		th.Logrus.Out = os.Stderr
+		return th.file.Close()
+	}
+
+	return nil
 }
@@ -0,0 +1,134 @@
+package psql
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// QueryInfo describe a named query that executed through DB
+type QueryInfo struct {
+	Name  string
+	SQL   string
+	Start time.Time
+}
+
+// QueryHook observe every named query, e.g. for metrics or tracing.
+// BeforeQuery may return a derived context that will be passed into the query and AfterQuery.
+type QueryHook interface {
+	BeforeQuery(ctx context.Context, q QueryInfo) context.Context
+	AfterQuery(ctx context.Context, q QueryInfo, err error)
+}
+
+// DB the pgx pool with named query helpers.
+// The pool methods are still available, but only the named ones are observed by the hooks.
+type DB struct {
+	*pgxpool.Pool
+
+	mu    sync.RWMutex
+	hooks []QueryHook
+}
+
+// New wrap the pgx pool
+func New(pool *pgxpool.Pool) *DB {
+	return &DB{Pool: pool}
+}
+
+// AddHook register a hook that observe the named queries
+func (db *DB) AddHook(hook QueryHook) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	db.hooks = append(db.hooks, hook)
+}
+
+func (db *DB) before(ctx context.Context, name, sql string) (context.Context, QueryInfo) {
+	q := QueryInfo{Name: name, SQL: sql, Start: time.Now()}
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	for _, h := range db.hooks {
+		ctx = h.BeforeQuery(ctx, q)
+	}
+
+	return ctx, q
+}
+
+func (db *DB) after(ctx context.Context, q QueryInfo, err error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	for i := len(db.hooks) - 1; i >= 0; i-- {
+		db.hooks[i].AfterQuery(ctx, q, err)
+	}
+}
+
+// QueryNamed run the query like pgxpool.Pool.Query, labelled with name.
+// The query is finished when the rows are closed or fully iterated.
+func (db *DB) QueryNamed(ctx context.Context, name, sql string, args ...interface{}) (pgx.Rows, error) {
+	ctx, q := db.before(ctx, name, sql)
+	rows, err := db.Pool.Query(ctx, sql, args...)
+	if err != nil {
+		db.after(ctx, q, err)
+		return rows, err
+	}
+
+	return &namedRows{Rows: rows, finish: func(err error) { db.after(ctx, q, err) }}, nil
+}
+
+// QueryRowNamed run the query like pgxpool.Pool.QueryRow, labelled with name.
+// The query is finished when the row is scanned.
+func (db *DB) QueryRowNamed(ctx context.Context, name, sql string, args ...interface{}) pgx.Row {
+	ctx, q := db.before(ctx, name, sql)
+	row := db.Pool.QueryRow(ctx, sql, args...)
+
+	return &namedRow{Row: row, finish: func(err error) { db.after(ctx, q, err) }}
+}
+
+// ExecNamed run the statement like pgxpool.Pool.Exec, labelled with name.
+func (db *DB) ExecNamed(ctx context.Context, name, sql string, args ...interface{}) (pgconn.CommandTag, error) {
+	ctx, q := db.before(ctx, name, sql)
+	tag, err := db.Pool.Exec(ctx, sql, args...)
+	db.after(ctx, q, err)
+
+	return tag, err
+}
+
+type namedRows struct {
+	pgx.Rows
+	once   sync.Once
+	finish func(err error)
+}
+
+func (r *namedRows) done() {
+	r.once.Do(func() { r.finish(r.Rows.Err()) })
+}
+
+func (r *namedRows) Next() bool {
+	next := r.Rows.Next()
+	if !next {
+		r.done()
+	}
+
+	return next
+}
+
+func (r *namedRows) Close() {
+	r.Rows.Close()
+	r.done()
+}
+
+type namedRow struct {
+	pgx.Row
+	finish func(err error)
+}
+
+func (r *namedRow) Scan(dest ...interface{}) error {
+	err := r.Row.Scan(dest...)
+	r.finish(err)
+
+	return err
+}
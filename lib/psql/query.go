@@ -0,0 +1,364 @@
+package psql
+
+import (
+	"errors"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ColumnType the type of the filter values of a column
+type ColumnType int
+
+// the column types
+const (
+	String ColumnType = iota
+	Int
+	Float
+	Bool
+	Time
+)
+
+// Operator a filter operator of the query string
+type Operator string
+
+// the filter operators, like and ilike match a substring
+const (
+	OpEq    Operator = "eq"
+	OpNe    Operator = "ne"
+	OpGt    Operator = "gt"
+	OpGte   Operator = "gte"
+	OpLt    Operator = "lt"
+	OpLte   Operator = "lte"
+	OpLike  Operator = "like"
+	OpILike Operator = "ilike"
+	OpIn    Operator = "in"
+	OpNull  Operator = "null"
+)
+
+// maxInValues the maximum number of values of an in filter
+const maxInValues = 100
+
+// typeOperators the operators allowed on a column type
+var typeOperators = map[ColumnType][]Operator{
+	String: {OpEq, OpNe, OpLike, OpILike, OpIn, OpNull},
+	Int:    {OpEq, OpNe, OpGt, OpGte, OpLt, OpLte, OpIn, OpNull},
+	Float:  {OpEq, OpNe, OpGt, OpGte, OpLt, OpLte, OpIn, OpNull},
+	Bool:   {OpEq, OpNe, OpNull},
+	Time:   {OpEq, OpNe, OpGt, OpGte, OpLt, OpLte, OpNull},
+}
+
+// Column a field of a resource that can be filtered or sorted
+type Column struct {
+	// Name the SQL expression of the column, e.g. "u.created_date", never taken from the request
+	Name string
+	Type ColumnType
+	// Operators the allowed filter operators, all the operators of the type when empty
+	Operators []Operator
+	// NoFilter and NoSort exclude the column from filtering or sorting
+	NoFilter bool
+	NoSort   bool
+}
+
+func (c Column) allows(op Operator) bool {
+	ops := c.Operators
+	if len(ops) == 0 {
+		ops = typeOperators[c.Type]
+	}
+
+	for _, o := range ops {
+		if o == op {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Resource the whitelist of the fields of a resource by their name in the query string
+type Resource map[string]Column
+
+// Filter a condition of the query string
+type Filter struct {
+	Field    string
+	Operator Operator
+	Value    interface{}
+}
+
+// Sort a sort field of the query string
+type Sort struct {
+	Field string
+	Desc  bool
+}
+
+// ListQuery the filters and sorts of a list request checked against a Resource
+type ListQuery struct {
+	Filters  []Filter
+	Sorts    []Sort
+	resource Resource
+}
+
+// ParamError a query string param that does not match the resource
+type ParamError struct {
+	Param   string
+	Message string
+}
+
+func (e *ParamError) Error() string {
+	return e.Param + ": " + e.Message
+}
+
+// ParseListQuery parse the sort and filter params of the query string:
+//
+//	sort=-created_date,name
+//	filter[status]=active
+//	filter[email][like]=gmail
+//	filter[id][in]=1,2,3
+//	filter[deleted_date][null]=true
+//
+// A field is accepted only when the resource has it and the operator is allowed on it.
+func ParseListQuery(query url.Values, resource Resource) (ListQuery, error) {
+	q := ListQuery{resource: resource}
+
+	if sorts := strings.TrimSpace(query.Get("sort")); len(sorts) > 0 {
+		seen := map[string]bool{}
+		for _, part := range strings.Split(sorts, ",") {
+			part = strings.TrimSpace(part)
+			s := Sort{Field: strings.TrimLeft(part, "+-"), Desc: strings.HasPrefix(part, "-")}
+
+			col, ok := resource[s.Field]
+			if !ok || col.NoSort {
+				return ListQuery{}, &ParamError{Param: "sort", Message: "cannot sort by " + strconv.Quote(s.Field)}
+			}
+			if seen[s.Field] {
+				continue
+			}
+			seen[s.Field] = true
+
+			q.Sorts = append(q.Sorts, s)
+		}
+	}
+
+	// the keys are sorted so the same filters give the same SQL
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		if !strings.HasPrefix(key, "filter[") {
+			continue
+		}
+
+		field, op, ok := parseFilterKey(key)
+		if !ok {
+			return ListQuery{}, &ParamError{Param: key, Message: "invalid filter, use filter[field] or filter[field][operator]"}
+		}
+
+		col, ok := resource[field]
+		if !ok || col.NoFilter {
+			return ListQuery{}, &ParamError{Param: key, Message: "cannot filter by " + strconv.Quote(field)}
+		}
+		if !col.allows(op) {
+			return ListQuery{}, &ParamError{Param: key, Message: "operator " + string(op) + " is not allowed on " + strconv.Quote(field)}
+		}
+
+		for _, raw := range query[key] {
+			value, err := parseFilterValue(col.Type, op, raw)
+			if err != nil {
+				return ListQuery{}, &ParamError{Param: key, Message: err.Error()}
+			}
+
+			q.Filters = append(q.Filters, Filter{Field: field, Operator: op, Value: value})
+		}
+	}
+
+	return q, nil
+}
+
+// parseFilterKey the field and operator of filter[field] or filter[field][op]
+func parseFilterKey(key string) (string, Operator, bool) {
+	if !strings.HasSuffix(key, "]") {
+		return "", "", false
+	}
+
+	parts := strings.Split(key[len("filter["):len(key)-1], "][")
+	switch len(parts) {
+	case 1:
+		return parts[0], OpEq, true
+	case 2:
+		return parts[0], Operator(strings.ToLower(parts[1])), true
+	}
+
+	return "", "", false
+}
+
+func parseFilterValue(typ ColumnType, op Operator, raw string) (interface{}, error) {
+	switch op {
+	case OpNull:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return nil, errInvalidValue("true or false")
+		}
+		return b, nil
+	case OpLike, OpILike:
+		return "%" + escapeLike(raw) + "%", nil
+	case OpIn:
+		return parseIn(typ, raw)
+	}
+
+	return parseTyped(typ, raw)
+}
+
+// parseIn the values of an in filter as a typed slice, pgx encode it as an array for = ANY($n)
+func parseIn(typ ColumnType, raw string) (interface{}, error) {
+	parts := strings.Split(raw, ",")
+	if len(parts) > maxInValues {
+		return nil, errInvalidValue("at most " + strconv.Itoa(maxInValues) + " values")
+	}
+
+	switch typ {
+	case Int:
+		values := make([]int64, 0, len(parts))
+		for _, p := range parts {
+			v, err := parseTyped(typ, strings.TrimSpace(p))
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, v.(int64))
+		}
+		return values, nil
+	case Float:
+		values := make([]float64, 0, len(parts))
+		for _, p := range parts {
+			v, err := parseTyped(typ, strings.TrimSpace(p))
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, v.(float64))
+		}
+		return values, nil
+	}
+
+	values := make([]string, 0, len(parts))
+	for _, p := range parts {
+		values = append(values, strings.TrimSpace(p))
+	}
+
+	return values, nil
+}
+
+func parseTyped(typ ColumnType, raw string) (interface{}, error) {
+	switch typ {
+	case Int:
+		v, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return nil, errInvalidValue("an integer")
+		}
+		return v, nil
+	case Float:
+		v, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return nil, errInvalidValue("a number")
+		}
+		return v, nil
+	case Bool:
+		v, err := strconv.ParseBool(raw)
+		if err != nil {
+			return nil, errInvalidValue("true or false")
+		}
+		return v, nil
+	case Time:
+		if v, err := time.Parse(time.RFC3339, raw); err == nil {
+			return v, nil
+		}
+		v, err := time.Parse("2006-01-02", raw)
+		if err != nil {
+			return nil, errInvalidValue("a RFC 3339 time or a date")
+		}
+		return v, nil
+	}
+
+	return raw, nil
+}
+
+func errInvalidValue(expected string) error {
+	return errors.New("the value must be " + expected)
+}
+
+// escapeLike escape the wildcards of a like pattern, the value is matched as it is
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+// Where the conditions of the filters joined by AND, with their values appended to args
+// as numbered placeholders, "TRUE" when there is no filter:
+//
+//	where, args := q.Where([]interface{}{memberID})
+//	sql := "SELECT ... FROM orders WHERE member_id = $1 AND " + where + " ORDER BY " + q.OrderBy("id DESC")
+func (q ListQuery) Where(args []interface{}) (string, []interface{}) {
+	if len(q.Filters) == 0 {
+		return "TRUE", args
+	}
+
+	conds := make([]string, 0, len(q.Filters))
+	for _, f := range q.Filters {
+		col := q.resource[f.Field].Name
+
+		if f.Operator == OpNull {
+			if f.Value.(bool) {
+				conds = append(conds, col+" IS NULL")
+			} else {
+				conds = append(conds, col+" IS NOT NULL")
+			}
+			continue
+		}
+
+		args = append(args, f.Value)
+		ph := "$" + strconv.Itoa(len(args))
+
+		switch f.Operator {
+		case OpEq:
+			conds = append(conds, col+" = "+ph)
+		case OpNe:
+			conds = append(conds, col+" <> "+ph)
+		case OpGt:
+			conds = append(conds, col+" > "+ph)
+		case OpGte:
+			conds = append(conds, col+" >= "+ph)
+		case OpLt:
+			conds = append(conds, col+" < "+ph)
+		case OpLte:
+			conds = append(conds, col+" <= "+ph)
+		case OpLike:
+			conds = append(conds, col+" LIKE "+ph)
+		case OpILike:
+			conds = append(conds, col+" ILIKE "+ph)
+		case OpIn:
+			conds = append(conds, col+" = ANY("+ph+")")
+		}
+	}
+
+	return strings.Join(conds, " AND "), args
+}
+
+// OrderBy the ORDER BY list of the sorts, dfl when there is no sort
+func (q ListQuery) OrderBy(dfl string) string {
+	if len(q.Sorts) == 0 {
+		return dfl
+	}
+
+	parts := make([]string, 0, len(q.Sorts))
+	for _, s := range q.Sorts {
+		dir := " ASC"
+		if s.Desc {
+			dir = " DESC"
+		}
+		parts = append(parts, q.resource[s.Field].Name+dir)
+	}
+
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,192 @@
+package psql
+
+import (
+	"errors"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+)
+
+var orderResource = Resource{
+	"id":           {Name: "o.id", Type: Int},
+	"status":       {Name: "o.status", Type: String, Operators: []Operator{OpEq, OpIn}},
+	"email":        {Name: "m.email", Type: String},
+	"total":        {Name: "o.total", Type: Float},
+	"paid":         {Name: "o.paid", Type: Bool},
+	"created_date": {Name: "o.created_date", Type: Time},
+	"deleted_date": {Name: "o.deleted_date", Type: Time, NoSort: true},
+	"note":         {Name: "o.note", Type: String, NoFilter: true},
+}
+
+func TestParseListQueryRejects(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		param string
+	}{
+		{"unknown sort key", "sort=password", "sort"},
+		{"sql in the sort key", "sort=id%3BDROP%20TABLE%20orders", "sort"},
+		{"one unknown sort key among known ones", "sort=-created_date,o.id", "sort"},
+		{"sort on a NoSort column", "sort=deleted_date", "sort"},
+		{"empty sort key", "sort=id,,total", "sort"},
+		{"unknown filter field", "filter[password]=x", "filter[password]"},
+		{"sql in the filter field", "filter[id)%20OR%20(1%3D1]=1", "filter[id) OR (1=1]"},
+		{"filter on a NoFilter column", "filter[note]=x", "filter[note]"},
+		{"operator not allowed on the column", "filter[status][like]=act", "filter[status][like]"},
+		{"operator not allowed on the type", "filter[paid][gt]=true", "filter[paid][gt]"},
+		{"unknown operator", "filter[id][between]=1", "filter[id][between]"},
+		{"too many brackets", "filter[id][eq][x]=1", "filter[id][eq][x]"},
+		{"unclosed bracket", "filter[id=1", "filter[id"},
+		{"not an integer", "filter[id]=1 OR 1=1", "filter[id]"},
+		{"not an integer in the list", "filter[id][in]=1,x", "filter[id][in]"},
+		{"not a time", "filter[created_date][gte]=yesterday", "filter[created_date][gte]"},
+		{"not a bool for null", "filter[deleted_date][null]=maybe", "filter[deleted_date][null]"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query, err := url.ParseQuery(tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			q, err := ParseListQuery(query, orderResource)
+			var pe *ParamError
+			if !errors.As(err, &pe) {
+				t.Fatalf("ParseListQuery(%q) = %+v, %v, want a ParamError", tt.query, q, err)
+			}
+			if pe.Param != tt.param {
+				t.Errorf("Param = %q, want %q", pe.Param, tt.param)
+			}
+		})
+	}
+}
+
+func TestListQueryWhere(t *testing.T) {
+	day := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name  string
+		query string
+		// args the args given to Where, the placeholders of the filters follow them
+		args      []interface{}
+		where     string
+		whereArgs []interface{}
+	}{
+		{
+			name:  "no filter",
+			query: "",
+			where: "TRUE",
+		},
+		{
+			name:      "no filter keep the args",
+			query:     "sort=id&page=2",
+			args:      []interface{}{int64(7)},
+			where:     "TRUE",
+			whereArgs: []interface{}{int64(7)},
+		},
+		{
+			name:      "eq without an offset",
+			query:     "filter[status]=active",
+			where:     "o.status = $1",
+			whereArgs: []interface{}{"active"},
+		},
+		{
+			name:      "placeholders after the args",
+			query:     "filter[status]=active&filter[total][gte]=10.5",
+			args:      []interface{}{int64(7), "member"},
+			where:     "o.status = $3 AND o.total >= $4",
+			whereArgs: []interface{}{int64(7), "member", "active", 10.5},
+		},
+		{
+			name:      "null takes no placeholder",
+			query:     "filter[deleted_date][null]=true&filter[id][gt]=5&filter[paid][null]=false",
+			args:      []interface{}{int64(7)},
+			where:     "o.deleted_date IS NULL AND o.id > $2 AND o.paid IS NOT NULL",
+			whereArgs: []interface{}{int64(7), int64(5)},
+		},
+		{
+			name:      "in is an array",
+			query:     "filter[id][in]=1, 2,3&filter[status][in]=active,paid",
+			where:     "o.id = ANY($1) AND o.status = ANY($2)",
+			whereArgs: []interface{}{[]int64{1, 2, 3}, []string{"active", "paid"}},
+		},
+		{
+			name:      "repeated filter",
+			query:     "filter[id][ne]=1&filter[id][ne]=2",
+			where:     "o.id <> $1 AND o.id <> $2",
+			whereArgs: []interface{}{int64(1), int64(2)},
+		},
+		{
+			name:      "time and date",
+			query:     "filter[created_date][lt]=2024-01-02",
+			where:     "o.created_date < $1",
+			whereArgs: []interface{}{day},
+		},
+		{
+			name:      "like is a substring",
+			query:     "filter[email][like]=gmail",
+			where:     "m.email LIKE $1",
+			whereArgs: []interface{}{"%gmail%"},
+		},
+		{
+			name:      "like escape the wildcards",
+			query:     `filter[email][ilike]=100%25_off\x`,
+			where:     "m.email ILIKE $1",
+			whereArgs: []interface{}{`%100\%\_off\\x%`},
+		},
+		{
+			name:      "the value stay out of the sql",
+			query:     "filter[email]=' OR '1'='1",
+			where:     "m.email = $1",
+			whereArgs: []interface{}{"' OR '1'='1"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query, err := url.ParseQuery(tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			q, err := ParseListQuery(query, orderResource)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			where, args := q.Where(tt.args)
+			if where != tt.where {
+				t.Errorf("where = %q, want %q", where, tt.where)
+			}
+			if !reflect.DeepEqual(args, tt.whereArgs) {
+				t.Errorf("args = %#v, want %#v", args, tt.whereArgs)
+			}
+		})
+	}
+}
+
+func TestListQueryOrderBy(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"", "o.id DESC"},
+		{"sort=created_date", "o.created_date ASC"},
+		{"sort=-created_date,+total", "o.created_date DESC, o.total ASC"},
+		{"sort=total,-total", "o.total ASC"},
+	}
+
+	for _, tt := range tests {
+		query, _ := url.ParseQuery(tt.query)
+		q, err := ParseListQuery(query, orderResource)
+		if err != nil {
+			t.Fatalf("ParseListQuery(%q): %v", tt.query, err)
+		}
+
+		if got := q.OrderBy("o.id DESC"); got != tt.want {
+			t.Errorf("OrderBy(%q) = %q, want %q", tt.query, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// sweepInterval how often the expired keys are removed from the memory limiter
+const sweepInterval = time.Minute
+
+// Memory an in process sliding window limiter, for a single instance and the test runs
+type Memory struct {
+	mu        sync.Mutex
+	hits      map[string][]time.Time
+	windows   map[string]time.Duration
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+// NewMemory create the in memory limiter
+func NewMemory() *Memory {
+	return &Memory{
+		hits:    map[string][]time.Time{},
+		windows: map[string]time.Duration{},
+		now:     time.Now,
+	}
+}
+
+// Allow implement Limiter
+func (m *Memory) Allow(ctx context.Context, key string, limit int, window time.Duration) (Result, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	m.sweep(now)
+
+	hits := prune(m.hits[key], now.Add(-window))
+	m.windows[key] = window
+
+	res := Result{Limit: limit}
+	if len(hits) < limit {
+		hits = append(hits, now)
+		res.Allowed = true
+		res.Remaining = limit - len(hits)
+	} else {
+		res.RetryAfter = hits[0].Add(window).Sub(now)
+	}
+	m.hits[key] = hits
+
+	if len(hits) > 0 {
+		res.Reset = hits[len(hits)-1].Add(window).Sub(now)
+	}
+
+	return res, nil
+}
+
+// sweep remove the keys without a hit in their window
+func (m *Memory) sweep(now time.Time) {
+	if now.Sub(m.lastSweep) < sweepInterval {
+		return
+	}
+	m.lastSweep = now
+
+	for key, hits := range m.hits {
+		hits = prune(hits, now.Add(-m.windows[key]))
+		if len(hits) == 0 {
+			delete(m.hits, key)
+			delete(m.windows, key)
+			continue
+		}
+		m.hits[key] = hits
+	}
+}
+
+// prune drop the hits older than since
+func prune(hits []time.Time, since time.Time) []time.Time {
+	i := 0
+	for i < len(hits) && !hits[i].After(since) {
+		i++
+	}
+
+	return hits[i:]
+}
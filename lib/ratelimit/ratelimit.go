@@ -0,0 +1,25 @@
+package ratelimit
+
+import (
+	"context"
+	"time"
+)
+
+// Result the outcome of a rate limit check
+type Result struct {
+	// Allowed is the request within the limit
+	Allowed bool
+	// Limit the number of requests allowed in the window
+	Limit int
+	// Remaining the requests left in the current window
+	Remaining int
+	// RetryAfter how long to wait before the next request is allowed, 0 when allowed
+	RetryAfter time.Duration
+	// Reset how long until the window is fully available again
+	Reset time.Duration
+}
+
+// Limiter a sliding window rate limiter: at most limit requests of key within window
+type Limiter interface {
+	Allow(ctx context.Context, key string, limit int, window time.Duration) (Result, error)
+}
@@ -0,0 +1,67 @@
+package ratelimit
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// slidingWindow keep the hits of the key in a sorted set scored by their time (ms),
+// return {allowed, remaining, retry after ms, reset ms}
+var slidingWindow = redis.NewScript(`
+local key = KEYS[1]
+local now = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local limit = tonumber(ARGV[3])
+
+redis.call('ZREMRANGEBYSCORE', key, '-inf', now - window)
+local count = redis.call('ZCARD', key)
+
+if count < limit then
+	redis.call('ZADD', key, now, ARGV[4])
+	redis.call('PEXPIRE', key, window)
+	return {1, limit - count - 1, 0, window}
+end
+
+local oldest = redis.call('ZRANGE', key, 0, 0, 'WITHSCORES')
+local newest = redis.call('ZRANGE', key, -1, -1, 'WITHSCORES')
+return {0, 0, tonumber(oldest[2]) + window - now, tonumber(newest[2]) + window - now}
+`)
+
+// Redis a sliding window limiter shared by every instance of the app
+type Redis struct {
+	client *redis.Client
+	prefix string
+}
+
+// NewRedis create the limiter, the keys are stored under prefix
+func NewRedis(client *redis.Client, prefix string) *Redis {
+	return &Redis{client: client, prefix: prefix}
+}
+
+// Allow implement Limiter
+func (l *Redis) Allow(ctx context.Context, key string, limit int, window time.Duration) (Result, error) {
+	now := time.Now().UnixNano() / int64(time.Millisecond)
+	// the member must be unique, two hits of the same millisecond are two entries
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	member := strconv.FormatInt(now, 10) + "-" + hex.EncodeToString(b)
+
+	values, err := slidingWindow.Run(ctx, l.client, []string{l.prefix + key},
+		now, window.Milliseconds(), limit, member).Int64Slice()
+	if err != nil {
+		return Result{}, err
+	}
+
+	return Result{
+		Allowed:    values[0] == 1,
+		Limit:      limit,
+		Remaining:  int(values[1]),
+		RetryAfter: time.Duration(values[2]) * time.Millisecond,
+		Reset:      time.Duration(values[3]) * time.Millisecond,
+	}, nil
+}
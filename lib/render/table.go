@@ -0,0 +1,268 @@
+package render
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrNotTabular the payload is not a struct or a slice of structs
+var ErrNotTabular = errors.New("render: the payload is not a struct or a slice of structs")
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// Column a column of a table export, taken from an exported struct field:
+// the key is its json name and the header its `header` tag, the key when there is none
+type Column struct {
+	Key    string
+	Header string
+	index  []int
+}
+
+// Value the value of the column in a row, nil when an embedded pointer on the way is nil
+func (c Column) Value(row reflect.Value) interface{} {
+	v := row
+	for _, i := range c.index {
+		for v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				return nil
+			}
+			v = v.Elem()
+		}
+		v = v.Field(i)
+	}
+
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+
+	return v.Interface()
+}
+
+// RowType the struct type of the rows of a payload: a struct, a slice or array of structs, or pointers to them
+func RowType(payload interface{}) (reflect.Type, error) {
+	t := reflect.TypeOf(payload)
+	if t == nil {
+		return nil, ErrNotTabular
+	}
+
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() == reflect.Slice || t.Kind() == reflect.Array {
+		t = t.Elem()
+		for t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+	}
+
+	if t.Kind() != reflect.Struct || t == timeType {
+		return nil, ErrNotTabular
+	}
+
+	return t, nil
+}
+
+// Columns the columns of the struct type, only the selected keys in their order when selected is not empty
+func Columns(t reflect.Type, selected []string) ([]Column, error) {
+	all := columnsOf(t, nil)
+	if len(selected) == 0 {
+		return all, nil
+	}
+
+	byKey := make(map[string]Column, len(all))
+	for _, c := range all {
+		byKey[c.Key] = c
+	}
+
+	cols := make([]Column, 0, len(selected))
+	for _, key := range selected {
+		c, ok := byKey[strings.TrimSpace(key)]
+		if !ok {
+			return nil, fmt.Errorf("unknown field %q", key)
+		}
+		cols = append(cols, c)
+	}
+
+	return cols, nil
+}
+
+func columnsOf(t reflect.Type, index []int) []Column {
+	var cols []Column
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		idx := append(append([]int{}, index...), i)
+
+		ft := f.Type
+		if ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+
+		name := strings.Split(f.Tag.Get("json"), ",")[0]
+		if f.Anonymous && len(name) == 0 && ft.Kind() == reflect.Struct {
+			cols = append(cols, columnsOf(ft, idx)...)
+			continue
+		}
+		if f.PkgPath != "" || name == "-" {
+			continue
+		}
+		if len(name) == 0 {
+			name = f.Name
+		}
+
+		header := f.Tag.Get("header")
+		if len(header) == 0 {
+			header = name
+		}
+
+		cols = append(cols, Column{Key: name, Header: header, index: idx})
+	}
+
+	return cols
+}
+
+// EachRow call fn with every row of the payload, a struct or a slice of structs
+func EachRow(payload interface{}, fn func(row reflect.Value) error) error {
+	v := reflect.ValueOf(payload)
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		return fn(v)
+	}
+
+	for i := 0; i < v.Len(); i++ {
+		row := v.Index(i)
+		for row.Kind() == reflect.Ptr {
+			if row.IsNil() {
+				break
+			}
+			row = row.Elem()
+		}
+		if row.Kind() != reflect.Struct {
+			continue
+		}
+
+		if err := fn(row); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// TableWriter write a table export row by row
+type TableWriter interface {
+	WriteHeader(headers []string) error
+	WriteRow(values []interface{}) error
+	Close() error
+}
+
+// CSVWriter write the rows as CSV
+type CSVWriter struct {
+	w *csv.Writer
+}
+
+// NewCSVWriter create a CSV table writer
+func NewCSVWriter(w io.Writer) *CSVWriter {
+	return &CSVWriter{w: csv.NewWriter(w)}
+}
+
+// WriteHeader write the header row
+func (c *CSVWriter) WriteHeader(headers []string) error {
+	return c.w.Write(headers)
+}
+
+// WriteRow write a row, the cells that a spreadsheet would run as a formula are prefixed with a quote
+func (c *CSVWriter) WriteRow(values []interface{}) error {
+	record := make([]string, len(values))
+	for i, v := range values {
+		s := FormatCell(v)
+		if len(s) > 0 && strings.ContainsRune("=+-@\t\r", rune(s[0])) && !isNumeric(v) {
+			s = "'" + s
+		}
+		record[i] = s
+	}
+
+	return c.w.Write(record)
+}
+
+// Close flush the buffered rows
+func (c *CSVWriter) Close() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+// Flush send the buffered rows
+func (c *CSVWriter) Flush() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+// FormatCell the text of a cell: RFC 3339 for a time, empty for nil
+func FormatCell(v interface{}) string {
+	switch x := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return x
+	case []byte:
+		return string(x)
+	case time.Time:
+		if x.IsZero() {
+			return ""
+		}
+		return x.Format(time.RFC3339)
+	case fmt.Stringer:
+		return x.String()
+	case float64:
+		return strconv.FormatFloat(x, 'f', -1, 64)
+	case float32:
+		return strconv.FormatFloat(float64(x), 'f', -1, 32)
+	}
+
+	return fmt.Sprint(v)
+}
+
+func isNumeric(v interface{}) bool {
+	switch reflect.ValueOf(v).Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+
+	return false
+}
+
+// Headers the header row of the columns
+func Headers(cols []Column) []string {
+	headers := make([]string, len(cols))
+	for i, c := range cols {
+		headers[i] = c.Header
+	}
+
+	return headers
+}
+
+// Values the cells of the row for the columns
+func Values(cols []Column, row reflect.Value) []interface{} {
+	values := make([]interface{}, len(cols))
+	for i, c := range cols {
+		values[i] = c.Value(row)
+	}
+
+	return values
+}
@@ -0,0 +1,60 @@
+package render
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestCSVWriterEscapesFormulas(t *testing.T) {
+	tests := []struct {
+		name  string
+		value interface{}
+		want  string
+	}{
+		{"plain text", "hello", "hello"},
+		{"formula", "=HYPERLINK(\"http://evil\")", "\"'=HYPERLINK(\"\"http://evil\"\")\""},
+		{"plus", "+62812", "'+62812"},
+		{"minus", "-1+1", "'-1+1"},
+		{"at", "@SUM(A1)", "'@SUM(A1)"},
+		{"tab", "\tcmd", "'\tcmd"},
+		{"carriage return", "\rcmd", "\"'\rcmd\""},
+		{"negative number", -5, "-5"},
+		{"negative float", -1.5, "-1.5"},
+		{"equal sign inside", "a=b", "a=b"},
+		{"nil", nil, ""},
+		{"time", time.Date(2024, 1, 2, 3, 4, 5, 0, time.FixedZone("WIB", 7*3600)), "2024-01-02T03:04:05+07:00"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			w := NewCSVWriter(&buf)
+			if err := w.WriteRow([]interface{}{tt.value}); err != nil {
+				t.Fatal(err)
+			}
+			if err := w.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			if got := buf.String(); got != tt.want+"\n" {
+				t.Errorf("row = %q, want %q", got, tt.want+"\n")
+			}
+		})
+	}
+}
+
+func TestCSVWriterHeader(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewCSVWriter(&buf)
+	_ = w.WriteHeader([]string{"Order ID", "Total, IDR"})
+	_ = w.WriteRow([]interface{}{int64(1), 15000})
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := "Order ID,\"Total, IDR\"\n1,15000\n"
+	if got := buf.String(); got != want {
+		t.Errorf("csv = %q, want %q", got, want)
+	}
+}
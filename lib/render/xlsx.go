@@ -0,0 +1,216 @@
+package render
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/xml"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// the parts of the workbook around the sheet, the cells hold inline strings so there is no shared strings part
+const (
+	xlsxContentTypes = xml.Header + `<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+		`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+		`<Default Extension="xml" ContentType="application/xml"/>` +
+		`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+		`<Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>` +
+		`<Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/>` +
+		`</Types>`
+
+	xlsxRels = xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+		`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+		`</Relationships>`
+
+	xlsxWorkbookRels = xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+		`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>` +
+		`<Relationship Id="rId2" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/>` +
+		`</Relationships>`
+
+	// the style 1 is the date time format of the time cells
+	xlsxStyles = xml.Header + `<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">` +
+		`<numFmts count="1"><numFmt numFmtId="164" formatCode="yyyy-mm-dd hh:mm:ss"/></numFmts>` +
+		`<fonts count="1"><font><sz val="11"/><name val="Calibri"/></font></fonts>` +
+		`<fills count="2"><fill><patternFill patternType="none"/></fill><fill><patternFill patternType="gray125"/></fill></fills>` +
+		`<borders count="1"><border><left/><right/><top/><bottom/><diagonal/></border></borders>` +
+		`<cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs>` +
+		`<cellXfs count="2"><xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/>` +
+		`<xf numFmtId="164" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/></cellXfs>` +
+		`</styleSheet>`
+
+	xlsxSheetStart = xml.Header + `<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`
+	xlsxSheetEnd   = `</sheetData></worksheet>`
+)
+
+// excelEpoch the day 0 of the serial dates of Excel
+var excelEpoch = time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)
+
+// XLSXWriter write the rows as a single sheet workbook, streamed: only the current row is held in memory
+type XLSXWriter struct {
+	zw    *zip.Writer
+	sheet *bufio.Writer
+	row   int
+	err   error
+}
+
+// NewXLSXWriter create a XLSX table writer, the sheet is named name
+func NewXLSXWriter(w io.Writer, name string) (*XLSXWriter, error) {
+	zw := zip.NewWriter(w)
+
+	var escaped strings.Builder
+	_ = xml.EscapeText(&escaped, []byte(sheetName(name)))
+
+	workbook := xml.Header + `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" ` +
+		`xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">` +
+		`<sheets><sheet name="` + escaped.String() + `" sheetId="1" r:id="rId1"/></sheets></workbook>`
+
+	for _, part := range []struct{ name, content string }{
+		{"[Content_Types].xml", xlsxContentTypes},
+		{"_rels/.rels", xlsxRels},
+		{"xl/workbook.xml", workbook},
+		{"xl/_rels/workbook.xml.rels", xlsxWorkbookRels},
+		{"xl/styles.xml", xlsxStyles},
+	} {
+		f, err := zw.Create(part.name)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := io.WriteString(f, part.content); err != nil {
+			return nil, err
+		}
+	}
+
+	f, err := zw.Create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		return nil, err
+	}
+
+	x := &XLSXWriter{zw: zw, sheet: bufio.NewWriter(f)}
+	_, x.err = x.sheet.WriteString(xlsxSheetStart)
+
+	return x, x.err
+}
+
+// sheetName a valid sheet name: at most 31 characters without []:*?/\
+func sheetName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`[]:*?/\`, r) {
+			return '_'
+		}
+		return r
+	}, name)
+
+	if r := []rune(name); len(r) > 31 {
+		name = string(r[:31])
+	}
+	if len(name) == 0 {
+		name = "Sheet1"
+	}
+
+	return name
+}
+
+// WriteHeader write the header row
+func (x *XLSXWriter) WriteHeader(headers []string) error {
+	values := make([]interface{}, len(headers))
+	for i, h := range headers {
+		values[i] = h
+	}
+
+	return x.WriteRow(values)
+}
+
+// WriteRow write a row, numbers, booleans and times keep their type.
+// Excel has no time zone, a time is written with the date and clock of its own location.
+func (x *XLSXWriter) WriteRow(values []interface{}) error {
+	if x.err != nil {
+		return x.err
+	}
+
+	x.row++
+	r := strconv.Itoa(x.row)
+
+	w := x.sheet
+	w.WriteString(`<row r="` + r + `">`)
+	for i, v := range values {
+		ref := columnName(i) + r
+
+		switch {
+		case v == nil:
+			continue
+		case isNumeric(v):
+			w.WriteString(`<c r="` + ref + `"><v>` + FormatCell(v) + `</v></c>`)
+		case reflect.ValueOf(v).Kind() == reflect.Bool:
+			b := "0"
+			if reflect.ValueOf(v).Bool() {
+				b = "1"
+			}
+			w.WriteString(`<c r="` + ref + `" t="b"><v>` + b + `</v></c>`)
+		default:
+			if t, ok := v.(time.Time); ok && !t.IsZero() {
+				w.WriteString(`<c r="` + ref + `" s="1"><v>` + strconv.FormatFloat(excelSerial(t), 'f', -1, 64) + `</v></c>`)
+				continue
+			}
+
+			s := FormatCell(v)
+			if len(s) == 0 {
+				continue
+			}
+
+			w.WriteString(`<c r="` + ref + `" t="inlineStr"><is><t xml:space="preserve">`)
+			_ = xml.EscapeText(w, []byte(s))
+			w.WriteString(`</t></is></c>`)
+		}
+	}
+	_, x.err = w.WriteString(`</row>`)
+
+	return x.err
+}
+
+// Flush send the rows written so far
+func (x *XLSXWriter) Flush() error {
+	if x.err != nil {
+		return x.err
+	}
+	if x.err = x.sheet.Flush(); x.err != nil {
+		return x.err
+	}
+
+	return x.zw.Flush()
+}
+
+// Close finish the sheet and the workbook
+func (x *XLSXWriter) Close() error {
+	if x.err != nil {
+		return x.err
+	}
+
+	if _, err := x.sheet.WriteString(xlsxSheetEnd); err != nil {
+		return err
+	}
+	if err := x.sheet.Flush(); err != nil {
+		return err
+	}
+
+	return x.zw.Close()
+}
+
+// excelSerial the serial date of the wall clock of t in its location, e.g. 07:00 WIB is 07:00 in the sheet
+func excelSerial(t time.Time) float64 {
+	wall := time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), time.UTC)
+
+	return wall.Sub(excelEpoch).Hours() / 24
+}
+
+// columnName the letters of the column i, 0 is A
+func columnName(i int) string {
+	name := ""
+	for i++; i > 0; i = (i - 1) / 26 {
+		name = string(rune('A'+(i-1)%26)) + name
+	}
+
+	return name
+}
@@ -0,0 +1,115 @@
+package render
+
+import (
+	"archive/zip"
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+)
+
+// readZip the parts of the zip archive by name
+func readZip(t *testing.T, data []byte) map[string]string {
+	t.Helper()
+
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("not a zip archive: %v", err)
+	}
+
+	parts := map[string]string{}
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, err := ioutil.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		parts[f.Name] = string(content)
+	}
+
+	return parts
+}
+
+func TestXLSXWriter(t *testing.T) {
+	wib := time.FixedZone("WIB", 7*3600)
+
+	var buf bytes.Buffer
+	x, err := NewXLSXWriter(&buf, "orders/2024")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := x.WriteHeader([]string{"ID", "Name", "Paid", "Created"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := x.WriteRow([]interface{}{int64(7), "Kopi & <Teh>", true, time.Date(2024, 1, 2, 7, 0, 0, 0, wib)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := x.WriteRow([]interface{}{1.5, "", false, time.Time{}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := x.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	parts := readZip(t, buf.Bytes())
+	for _, name := range []string{"[Content_Types].xml", "_rels/.rels", "xl/workbook.xml", "xl/_rels/workbook.xml.rels", "xl/styles.xml", "xl/worksheets/sheet1.xml"} {
+		if _, ok := parts[name]; !ok {
+			t.Errorf("missing part %s", name)
+		}
+	}
+
+	if !strings.Contains(parts["xl/workbook.xml"], `<sheet name="orders_2024"`) {
+		t.Errorf("workbook = %s, want the sheet orders_2024", parts["xl/workbook.xml"])
+	}
+
+	sheet := parts["xl/worksheets/sheet1.xml"]
+	for _, want := range []string{
+		`<row r="1"><c r="A1" t="inlineStr"><is><t xml:space="preserve">ID</t></is></c>`,
+		`<c r="A2"><v>7</v></c>`,
+		`<c r="B2" t="inlineStr"><is><t xml:space="preserve">Kopi &amp; &lt;Teh&gt;</t></is></c>`,
+		`<c r="C2" t="b"><v>1</v></c>`,
+		// 2024-01-02 07:00 in its own zone, not 00:00 UTC
+		`<c r="D2" s="1"><v>45293.291666666664</v></c>`,
+		`<row r="3"><c r="A3"><v>1.5</v></c><c r="C3" t="b"><v>0</v></c></row>`,
+		`</sheetData></worksheet>`,
+	} {
+		if !strings.Contains(sheet, want) {
+			t.Errorf("sheet does not contain %s:\n%s", want, sheet)
+		}
+	}
+}
+
+func TestSheetName(t *testing.T) {
+	tests := []struct{ name, want string }{
+		{"orders", "orders"},
+		{"a[b]:c*d?e/f\\g", "a_b__c_d_e_f_g"},
+		{"", "Sheet1"},
+		{strings.Repeat("x", 40), strings.Repeat("x", 31)},
+	}
+
+	for _, tt := range tests {
+		if got := sheetName(tt.name); got != tt.want {
+			t.Errorf("sheetName(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestColumnName(t *testing.T) {
+	tests := []struct {
+		i    int
+		want string
+	}{
+		{0, "A"}, {25, "Z"}, {26, "AA"}, {51, "AZ"}, {52, "BA"}, {701, "ZZ"}, {702, "AAA"},
+	}
+
+	for _, tt := range tests {
+		if got := columnName(tt.i); got != tt.want {
+			t.Errorf("columnName(%d) = %q, want %q", tt.i, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package signature
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// sweepInterval how often the expired nonces are removed from the memory store
+const sweepInterval = time.Minute
+
+// NonceStore remember the used nonces, Use is false when the nonce was already used within ttl
+type NonceStore interface {
+	Use(ctx context.Context, nonce string, ttl time.Duration) (bool, error)
+}
+
+// RedisNonceStore the nonces shared by every instance of the app
+type RedisNonceStore struct {
+	client *redis.Client
+	prefix string
+}
+
+// NewRedisNonceStore create the store, the nonces are stored under prefix
+func NewRedisNonceStore(client *redis.Client, prefix string) *RedisNonceStore {
+	return &RedisNonceStore{client: client, prefix: prefix}
+}
+
+// Use implement NonceStore
+func (s *RedisNonceStore) Use(ctx context.Context, nonce string, ttl time.Duration) (bool, error) {
+	return s.client.SetNX(ctx, s.prefix+nonce, 1, ttl).Result()
+}
+
+// MemoryNonceStore the nonces kept in the process, a replay on another instance is not detected
+type MemoryNonceStore struct {
+	mu        sync.Mutex
+	expires   map[string]time.Time
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+// NewMemoryNonceStore create the in memory store
+func NewMemoryNonceStore() *MemoryNonceStore {
+	return &MemoryNonceStore{expires: map[string]time.Time{}, now: time.Now}
+}
+
+// Use implement NonceStore
+func (s *MemoryNonceStore) Use(ctx context.Context, nonce string, ttl time.Duration) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	s.sweep(now)
+
+	if exp, ok := s.expires[nonce]; ok && now.Before(exp) {
+		return false, nil
+	}
+	s.expires[nonce] = now.Add(ttl)
+
+	return true, nil
+}
+
+// sweep remove the expired nonces
+func (s *MemoryNonceStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < sweepInterval {
+		return
+	}
+	s.lastSweep = now
+
+	for nonce, exp := range s.expires {
+		if !now.Before(exp) {
+			delete(s.expires, nonce)
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package signature
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// the headers of a signed request
+const (
+	HeaderSignature = "X-SIGNATURE"
+	HeaderTimestamp = "X-TIMESTAMPT"
+	HeaderClientID  = "X-CLIENT-ID"
+	HeaderNonce     = "X-NONCE"
+)
+
+// Canonical build the string to sign:
+//
+//	METHOD \n PATH \n CANONICAL_QUERY \n HEX(SHA256(BODY)) \n TIMESTAMP \n NONCE
+//
+// The query keys and values are sorted and escaped, so the parameter order does not matter.
+func Canonical(method, path string, query url.Values, bodyHash, timestamp, nonce string) string {
+	if len(path) == 0 {
+		path = "/"
+	}
+
+	return strings.Join([]string{
+		strings.ToUpper(method),
+		path,
+		CanonicalQuery(query),
+		bodyHash,
+		timestamp,
+		nonce,
+	}, "\n")
+}
+
+// CanonicalQuery the query sorted by key then value
+func CanonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	parts := make([]string, 0, len(query))
+	for _, k := range keys {
+		values := append([]string{}, query[k]...)
+		sort.Strings(values)
+		for _, v := range values {
+			parts = append(parts, url.QueryEscape(k)+"="+url.QueryEscape(v))
+		}
+	}
+
+	return strings.Join(parts, "&")
+}
+
+// BodyHash the hex sha256 of the body
+func BodyHash(body []byte) string {
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:])
+}
+
+// Sign the hex HMAC-SHA256 of the canonical string
+func Sign(secret, canonical string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	_, _ = mac.Write([]byte(canonical))
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify compare the signature with the expected one in constant time
+func Verify(secret, canonical, sig string) bool {
+	expected, err := hex.DecodeString(Sign(secret, canonical))
+	if err != nil {
+		return false
+	}
+
+	given, err := hex.DecodeString(sig)
+	if err != nil {
+		return false
+	}
+
+	return hmac.Equal(expected, given)
+}
+
+// ReadBody read the request body and put it back so the next reader get it again
+func ReadBody(r *http.Request) ([]byte, error) {
+	if r.Body == nil || r.Body == http.NoBody {
+		return nil, nil
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	_ = r.Body.Close()
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	return body, err
+}
+
+// NewNonce a random hex nonce
+func NewNonce() (string, error) {
+	b := make([]byte, 16)
+	if _, err := io.ReadFull(rand.Reader, b); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
+
+// SignRequest add the client id, timestamp, nonce and signature headers into the request
+func SignRequest(r *http.Request, clientID, secret string) error {
+	body, err := ReadBody(r)
+	if err != nil {
+		return err
+	}
+
+	nonce, err := NewNonce()
+	if err != nil {
+		return err
+	}
+
+	ts := strconv.FormatInt(time.Now().Unix(), 10)
+	canonical := Canonical(r.Method, r.URL.EscapedPath(), r.URL.Query(), BodyHash(body), ts, nonce)
+
+	r.Header.Set(HeaderClientID, clientID)
+	r.Header.Set(HeaderTimestamp, ts)
+	r.Header.Set(HeaderNonce, nonce)
+	r.Header.Set(HeaderSignature, Sign(secret, canonical))
+
+	return nil
+}
+
+// Transport sign every outgoing request, used by our own services to call the signed routes
+type Transport struct {
+	ClientID string
+	Secret   string
+	Base     http.RoundTripper
+}
+
+// RoundTrip implement http.RoundTripper
+func (t Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	// a RoundTripper must not modify the given request
+	req = req.Clone(req.Context())
+	if err := SignRequest(req, t.ClientID, t.Secret); err != nil {
+		return nil, err
+	}
+
+	return base.RoundTrip(req)
+}
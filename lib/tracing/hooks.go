@@ -0,0 +1,178 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"hypefast-api/lib/psql"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/jackc/pgx/v4"
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// QueryHook start a client span for every named query of psql.DB
+type QueryHook struct{}
+
+// BeforeQuery implement psql.QueryHook
+func (QueryHook) BeforeQuery(ctx context.Context, q psql.QueryInfo) context.Context {
+	ctx, _ = Tracer().Start(ctx, "db "+q.Name,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithTimestamp(q.Start),
+		trace.WithAttributes(
+			semconv.DBSystemPostgreSQL,
+			semconv.DBStatement(q.SQL),
+			semconv.DBOperation(q.Name),
+		),
+	)
+
+	return ctx
+}
+
+// AfterQuery implement psql.QueryHook
+func (QueryHook) AfterQuery(ctx context.Context, q psql.QueryInfo, err error) {
+	span := trace.SpanFromContext(ctx)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// RedisHook start a client span for every command of a redis client
+type RedisHook struct {
+	// Client name of the redis client, e.g. default or cache
+	Client string
+}
+
+// BeforeProcess implement redis.Hook
+func (h RedisHook) BeforeProcess(ctx context.Context, cmd redis.Cmder) (context.Context, error) {
+	ctx, _ = Tracer().Start(ctx, "redis "+strings.ToLower(cmd.Name()),
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.DBSystemRedis,
+			semconv.DBOperation(cmd.Name()),
+			attribute.String("db.redis.client", h.Client),
+		),
+	)
+
+	return ctx, nil
+}
+
+// AfterProcess implement redis.Hook
+func (h RedisHook) AfterProcess(ctx context.Context, cmd redis.Cmder) error {
+	endRedisSpan(ctx, cmd.Err())
+	return nil
+}
+
+// BeforeProcessPipeline implement redis.Hook
+func (h RedisHook) BeforeProcessPipeline(ctx context.Context, cmds []redis.Cmder) (context.Context, error) {
+	names := make([]string, 0, len(cmds))
+	for _, cmd := range cmds {
+		names = append(names, strings.ToLower(cmd.Name()))
+	}
+
+	ctx, _ = Tracer().Start(ctx, "redis pipeline",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.DBSystemRedis,
+			semconv.DBOperation("pipeline"),
+			attribute.String("db.redis.client", h.Client),
+			attribute.StringSlice("db.redis.commands", names),
+		),
+	)
+
+	return ctx, nil
+}
+
+// AfterProcessPipeline implement redis.Hook
+func (h RedisHook) AfterProcessPipeline(ctx context.Context, cmds []redis.Cmder) error {
+	var err error
+	for _, cmd := range cmds {
+		if cmd.Err() != nil && cmd.Err() != redis.Nil {
+			err = cmd.Err()
+			break
+		}
+	}
+	endRedisSpan(ctx, err)
+
+	return nil
+}
+
+func endRedisSpan(ctx context.Context, err error) {
+	span := trace.SpanFromContext(ctx)
+	if err != nil && err != redis.Nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// LogHook add the trace and span id into the log entries that created with WithContext
+type LogHook struct{}
+
+// Levels implement logrus.Hook
+func (LogHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+// Fire implement logrus.Hook
+func (LogHook) Fire(entry *logrus.Entry) error {
+	if entry.Context == nil {
+		return nil
+	}
+
+	sc := trace.SpanContextFromContext(entry.Context)
+	if sc.IsValid() {
+		entry.Data["trace_id"] = sc.TraceID().String()
+		entry.Data["span_id"] = sc.SpanID().String()
+	}
+
+	return nil
+}
+
+// Transport propagate the trace context into the outgoing requests
+// and start a client span for each of them.
+type Transport struct {
+	Base http.RoundTripper
+}
+
+// RoundTrip implement http.RoundTripper
+func (t Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	ctx, span := Tracer().Start(req.Context(), "HTTP "+req.Method,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.HTTPMethod(req.Method),
+			semconv.HTTPURL(req.URL.String()),
+		),
+	)
+	defer span.End()
+
+	req = req.Clone(ctx)
+	Inject(ctx, req.Header)
+
+	resp, err := base.RoundTrip(req)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return resp, err
+	}
+
+	span.SetAttributes(semconv.HTTPStatusCode(resp.StatusCode))
+	if resp.StatusCode >= http.StatusInternalServerError {
+		span.SetStatus(codes.Error, resp.Status)
+	}
+
+	return resp, nil
+}
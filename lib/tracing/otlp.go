@@ -0,0 +1,36 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// NewOTLPExporter create an exporter that post the spans into the OTLP/HTTP endpoint,
+// e.g. http://localhost:4318/v1/traces, a http:// endpoint is sent without TLS.
+func NewOTLPExporter(endpoint string, headers map[string]string) (sdktrace.SpanExporter, error) {
+	if len(endpoint) == 0 {
+		return nil, fmt.Errorf("tracing endpoint is required by the otlp exporter")
+	}
+
+	u, err := url.Parse(endpoint)
+	if err != nil || len(u.Host) == 0 {
+		return nil, fmt.Errorf("invalid tracing endpoint %q", endpoint)
+	}
+
+	opts := []otlptracehttp.Option{
+		otlptracehttp.WithEndpoint(u.Host),
+		otlptracehttp.WithHeaders(headers),
+	}
+	if len(u.Path) > 0 {
+		opts = append(opts, otlptracehttp.WithURLPath(u.Path))
+	}
+	if u.Scheme == "http" {
+		opts = append(opts, otlptracehttp.WithInsecure())
+	}
+
+	return otlptracehttp.New(context.Background(), opts...)
+}
@@ -0,0 +1,150 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// ExporterOTLP export the spans into an OTLP/HTTP collector
+	ExporterOTLP = "otlp"
+
+	// ExporterStdout print the spans into stdout, for local runs
+	ExporterStdout = "stdout"
+
+	// ExporterFile write the spans into a file, for local runs
+	ExporterFile = "file"
+
+	// TraceIDHeader response header that hold the trace id of the request
+	TraceIDHeader = "X-Trace-Id"
+
+	instrumentationName = "hypefast-api"
+)
+
+// Options of the tracing provider
+type Options struct {
+	ServiceName    string
+	ServiceVersion string
+	Exporter       string
+	Endpoint       string
+	Headers        map[string]string
+	File           string
+	SampleRatio    float64
+}
+
+// Provider hold the tracer provider and the resources of the exporter
+type Provider struct {
+	tp     *sdktrace.TracerProvider
+	closer io.Closer
+}
+
+// New create the tracer provider and set it as the global provider,
+// together with the W3C trace context and baggage propagators.
+func New(opts Options) (*Provider, error) {
+	p := &Provider{}
+
+	var (
+		exp sdktrace.SpanExporter
+		err error
+	)
+	switch opts.Exporter {
+	case ExporterOTLP:
+		exp, err = NewOTLPExporter(opts.Endpoint, opts.Headers)
+	case ExporterStdout, "":
+		exp, err = stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+	case ExporterFile:
+		var file *os.File
+		file, err = os.OpenFile(opts.File, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+		if err != nil {
+			return nil, err
+		}
+		p.closer = file
+		exp, err = stdouttrace.New(stdouttrace.WithWriter(file))
+	default:
+		err = fmt.Errorf("unknown tracing exporter %q", opts.Exporter)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := resource.New(context.Background(),
+		resource.WithTelemetrySDK(),
+		resource.WithHost(),
+		resource.WithAttributes(
+			semconv.ServiceName(opts.ServiceName),
+			semconv.ServiceVersion(opts.ServiceVersion),
+		),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	ratio := opts.SampleRatio
+	if ratio <= 0 || ratio > 1 {
+		ratio = 1
+	}
+
+	p.tp = sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exp),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(ratio))),
+	)
+
+	otel.SetTracerProvider(p.tp)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+
+	return p, nil
+}
+
+// Shutdown flush the remaining spans and close the exporter
+func (p *Provider) Shutdown(ctx context.Context) error {
+	if p == nil {
+		return nil
+	}
+
+	err := p.tp.Shutdown(ctx)
+	if p.closer != nil {
+		_ = p.closer.Close()
+	}
+
+	return err
+}
+
+// Tracer give the tracer of the app. It is a no-op tracer when tracing is not set up.
+func Tracer() trace.Tracer {
+	return otel.Tracer(instrumentationName)
+}
+
+// Extract read the W3C trace context of the incoming request headers
+func Extract(ctx context.Context, header http.Header) context.Context {
+	return otel.GetTextMapPropagator().Extract(ctx, propagation.HeaderCarrier(header))
+}
+
+// Inject write the trace context of ctx into the outgoing request headers
+func Inject(ctx context.Context, header http.Header) {
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(header))
+}
+
+// TraceID give the trace id of the span in ctx, empty when there is no span.
+func TraceID(ctx context.Context) string {
+	sc := trace.SpanContextFromContext(ctx)
+	if !sc.IsValid() {
+		return ""
+	}
+
+	return sc.TraceID().String()
+}
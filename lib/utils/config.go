@@ -2,6 +2,7 @@ package utils
 
 import (
 	"strings"
+	"time"
 
 	"github.com/spf13/viper"
 )
@@ -11,6 +12,11 @@ type Config interface {
 	GetString(key string) string
 	GetInt(key string) int
 	GetBool(key string) bool
+	GetFloat64(key string) float64
+	GetDuration(key string) time.Duration
+	GetStringSlice(key string) []string
+	GetStringMapString(key string) map[string]string
+	AllSettings() map[string]interface{}
 	initialize(basepath, configPath string)
 }
 
@@ -46,6 +52,31 @@ func (v *viperConfig) GetBool(key string) bool {
 	return viper.GetBool(key)
 }
 
+// GetFloat64 get float64 value from config file.
+func (v *viperConfig) GetFloat64(key string) float64 {
+	return viper.GetFloat64(key)
+}
+
+// GetDuration get duration value (e.g. "5s") from config file.
+func (v *viperConfig) GetDuration(key string) time.Duration {
+	return viper.GetDuration(key)
+}
+
+// GetStringSlice get slice of string value from config file.
+func (v *viperConfig) GetStringSlice(key string) []string {
+	return viper.GetStringSlice(key)
+}
+
+// GetStringMapString get map of string value from config file.
+func (v *viperConfig) GetStringMapString(key string) map[string]string {
+	return viper.GetStringMapString(key)
+}
+
+// AllSettings get every value of the config file (and the environment overrides) as a nested map.
+func (v *viperConfig) AllSettings() map[string]interface{} {
+	return viper.AllSettings()
+}
+
 // NewViperConfig new instance of configuration
 func NewViperConfig(basepath, configPath string) Config {
 	v := &viperConfig{}
@@ -0,0 +1,138 @@
+package validation
+
+import (
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	e164Regex     = regexp.MustCompile(`^\+[1-9][0-9]{7,14}$`)
+	idMobileRegex = regexp.MustCompile(`^\+628[1-9][0-9]{7,10}$`)
+	npwpRegex     = regexp.MustCompile(`^[0-9]{2}\.[0-9]{3}\.[0-9]{3}\.[0-9]-[0-9]{3}\.[0-9]{3}$`)
+	kodePosRegex  = regexp.MustCompile(`^[1-9][0-9]{4}$`)
+	userCodeRegex = regexp.MustCompile(`^u-[a-zA-Z0-9]{8}$`)
+	digitsRegex   = regexp.MustCompile(`^[0-9]+$`)
+
+	phoneSeparators = strings.NewReplacer(" ", "", "-", "", ".", "", "(", "", ")", "")
+)
+
+// the errors of ParseNIK
+var (
+	ErrNIKFormat    = errors.New("nik must be 16 digits")
+	ErrNIKRegion    = errors.New("nik has an invalid region code")
+	ErrNIKBirthDate = errors.New("nik has an invalid birth date")
+	ErrNIKSerial    = errors.New("nik has an invalid serial number")
+)
+
+// IsE164 the phone number is in the E.164 format, e.g. +6281234567890
+func IsE164(s string) bool {
+	return e164Regex.MatchString(s)
+}
+
+// NormalizeIDPhone the E.164 form of an Indonesian phone number written as 08.., 628.. or +628..,
+// spaces, dashes, dots and parentheses are ignored
+func NormalizeIDPhone(s string) string {
+	s = phoneSeparators.Replace(strings.TrimSpace(s))
+
+	switch {
+	case strings.HasPrefix(s, "+"):
+		return s
+	case strings.HasPrefix(s, "62"):
+		return "+" + s
+	case strings.HasPrefix(s, "0"):
+		return "+62" + s[1:]
+	}
+
+	return s
+}
+
+// IsIDMobile the phone number is an Indonesian mobile number (+628.., 628.. or 08..) of 10 to 13 digits
+func IsIDMobile(s string) bool {
+	return idMobileRegex.MatchString(NormalizeIDPhone(s))
+}
+
+// NIK the parts of a Nomor Induk Kependudukan
+type NIK struct {
+	Province  string
+	Regency   string
+	District  string
+	BirthDate time.Time
+	Female    bool
+	Serial    string
+}
+
+// ParseNIK parse the 16 digits NIK: the province, regency and district codes, the birth date as DDMMYY
+// with 40 added to the day for a woman, and a serial number not 0000.
+// The birth date must be a real date in the past, the century is the one that put it in the past.
+func ParseNIK(s string) (NIK, error) {
+	if len(s) != 16 || !digitsRegex.MatchString(s) {
+		return NIK{}, ErrNIKFormat
+	}
+
+	nik := NIK{Province: s[0:2], Regency: s[2:4], District: s[4:6], Serial: s[12:16]}
+	if nik.Province < "11" || nik.Province > "96" || nik.Regency == "00" || nik.District == "00" {
+		return NIK{}, ErrNIKRegion
+	}
+	if nik.Serial == "0000" {
+		return NIK{}, ErrNIKSerial
+	}
+
+	day, _ := strconv.Atoi(s[6:8])
+	month, _ := strconv.Atoi(s[8:10])
+	year, _ := strconv.Atoi(s[10:12])
+	if day > 40 {
+		nik.Female = true
+		day -= 40
+	}
+	if day < 1 || day > 31 || month < 1 || month > 12 {
+		return NIK{}, ErrNIKBirthDate
+	}
+
+	year += 2000
+	if time.Date(year, time.Month(month), day, 0, 0, 0, 0, time.UTC).After(time.Now()) {
+		year -= 100
+	}
+
+	// a day that does not exist in the month, e.g. 31 February, is normalized into the next month
+	birth := time.Date(year, time.Month(month), day, 0, 0, 0, 0, time.UTC)
+	if birth.Day() != day {
+		return NIK{}, ErrNIKBirthDate
+	}
+	nik.BirthDate = birth
+
+	return nik, nil
+}
+
+// IsNIK the NIK is valid, see ParseNIK
+func IsNIK(s string) bool {
+	_, err := ParseNIK(s)
+	return err == nil
+}
+
+// IsNPWP the NPWP is the 15 digits number, formatted 99.999.999.9-999.999 or not,
+// or the 16 digits number given since 2024 (the NIK for a person)
+func IsNPWP(s string) bool {
+	if npwpRegex.MatchString(s) {
+		return true
+	}
+
+	return (len(s) == 15 || len(s) == 16) && digitsRegex.MatchString(s)
+}
+
+// IsKodePos the Indonesian postal code, 5 digits from 10000
+func IsKodePos(s string) bool {
+	return kodePosRegex.MatchString(s)
+}
+
+// IsUserCode the user code of the users table, u- followed by 8 letters or digits
+func IsUserCode(s string) bool {
+	return userCodeRegex.MatchString(s)
+}
+
+// IsIDRString the amount in rupiah written as a whole non negative number, without separators
+func IsIDRString(s string) bool {
+	return digitsRegex.MatchString(s)
+}
@@ -0,0 +1,129 @@
+package validation
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseNIK(t *testing.T) {
+	tests := []struct {
+		name   string
+		nik    string
+		err    error
+		birth  time.Time
+		female bool
+	}{
+		{"man", "3201011205900001", nil, time.Date(1990, time.May, 12, 0, 0, 0, 0, time.UTC), false},
+		{"woman has 40 added to the day", "3201015205900001", nil, time.Date(1990, time.May, 12, 0, 0, 0, 0, time.UTC), true},
+		{"born in the 2000s", "3171010101100001", nil, time.Date(2010, time.January, 1, 0, 0, 0, 0, time.UTC), false},
+		{"a future year is the previous century", "3171010101990001", nil, time.Date(1999, time.January, 1, 0, 0, 0, 0, time.UTC), false},
+		{"leap day", "3201012902000001", nil, time.Date(2000, time.February, 29, 0, 0, 0, 0, time.UTC), false},
+		{"too short", "320101120590001", ErrNIKFormat, time.Time{}, false},
+		{"not digits", "32010112059000a1", ErrNIKFormat, time.Time{}, false},
+		{"province below 11", "1001011205900001", ErrNIKRegion, time.Time{}, false},
+		{"province above 96", "9701011205900001", ErrNIKRegion, time.Time{}, false},
+		{"regency 00", "3200011205900001", ErrNIKRegion, time.Time{}, false},
+		{"district 00", "3201001205900001", ErrNIKRegion, time.Time{}, false},
+		{"serial 0000", "3201011205900000", ErrNIKSerial, time.Time{}, false},
+		{"month 13", "3201011213900001", ErrNIKBirthDate, time.Time{}, false},
+		{"day 0", "3201010005900001", ErrNIKBirthDate, time.Time{}, false},
+		{"day 32", "3201013205900001", ErrNIKBirthDate, time.Time{}, false},
+		{"31 February", "3201013102900001", ErrNIKBirthDate, time.Time{}, false},
+		{"29 February of a common year", "3201012902010001", ErrNIKBirthDate, time.Time{}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nik, err := ParseNIK(tt.nik)
+			if err != tt.err {
+				t.Fatalf("ParseNIK(%q) error = %v, want %v", tt.nik, err, tt.err)
+			}
+			if err != nil {
+				return
+			}
+
+			if !nik.BirthDate.Equal(tt.birth) {
+				t.Errorf("BirthDate = %v, want %v", nik.BirthDate, tt.birth)
+			}
+			if nik.Female != tt.female {
+				t.Errorf("Female = %v, want %v", nik.Female, tt.female)
+			}
+			if nik.Province != tt.nik[0:2] || nik.Regency != tt.nik[2:4] || nik.District != tt.nik[4:6] || nik.Serial != tt.nik[12:16] {
+				t.Errorf("codes = %+v", nik)
+			}
+			if !IsNIK(tt.nik) {
+				t.Errorf("IsNIK(%q) = false", tt.nik)
+			}
+		})
+	}
+}
+
+func TestIsNPWP(t *testing.T) {
+	tests := []struct {
+		npwp string
+		want bool
+	}{
+		{"01.234.567.8-901.000", true},
+		{"012345678901000", true},
+		{"3201011205900001", true},
+		{"01.234.567.8-901", false},
+		{"01.234.567.8.901.000", false},
+		{"01234567890100", false},
+		{"01234567890100001", false},
+		{"01234567890100a", false},
+		{"", false},
+	}
+
+	for _, tt := range tests {
+		if got := IsNPWP(tt.npwp); got != tt.want {
+			t.Errorf("IsNPWP(%q) = %v, want %v", tt.npwp, got, tt.want)
+		}
+	}
+}
+
+func TestIsIDMobile(t *testing.T) {
+	tests := []struct {
+		phone string
+		want  bool
+	}{
+		{"081234567890", true},
+		{"6281234567890", true},
+		{"+6281234567890", true},
+		{"0812-3456-7890", true},
+		{"+62 812 3456 7890", true},
+		{"(0812) 3456.7890", true},
+		{"0812345678", true},
+		{"08123456789012", false},
+		{"081234567", false},
+		{"0212345678", false},
+		{"0801234567890", false},
+		{"+6581234567", false},
+		{"0812abc67890", false},
+		{"", false},
+	}
+
+	for _, tt := range tests {
+		if got := IsIDMobile(tt.phone); got != tt.want {
+			t.Errorf("IsIDMobile(%q) = %v, want %v", tt.phone, got, tt.want)
+		}
+	}
+}
+
+func TestNormalizeIDPhone(t *testing.T) {
+	tests := []struct {
+		phone string
+		want  string
+	}{
+		{"081234567890", "+6281234567890"},
+		{"6281234567890", "+6281234567890"},
+		{" +62 812-3456-7890 ", "+6281234567890"},
+		{"(0812) 3456.7890", "+6281234567890"},
+		{"+6581234567", "+6581234567"},
+	}
+
+	for _, tt := range tests {
+		if got := NormalizeIDPhone(tt.phone); got != tt.want {
+			t.Errorf("NormalizeIDPhone(%q) = %q, want %q", tt.phone, got, tt.want)
+		}
+	}
+}
@@ -63,6 +63,11 @@ func setup() {
 		fmt.Println("[redis-cache] " + err.Error())
 	}
 
+	tp, err := bootstrap.SetupTracing(config)
+	if err != nil {
+		fmt.Println("[tracing] " + err.Error())
+	}
+
 	app = &bootstrap.App{
 		Debug:      debug,
 		Config:     config,
@@ -70,6 +75,10 @@ func setup() {
 		Log:        cLog,
 		Redis:      rd,
 		RedisCache: rdCache,
+		Cache:      bootstrap.SetupCache(rdCache, config),
+		I18n:       bootstrap.SetupI18n(config),
+		Metrics:    bootstrap.SetupMetrics(),
+		Tracing:    tp,
 	}
 }
 
@@ -82,13 +91,13 @@ func main() {
 		Commands: []*cli.Command{
 			{
 				Name:   "api",
-				Usage:  "API service. Run on http 1/1",
+				Usage:  "API service. Run on HTTP/1.1 and HTTP/2 (TLS or h2c)",
 				Flags:  api.Flags,
 				Action: api.Boot{App: app}.Start,
 			},
 		},
 		Action: func(cli *cli.Context) error {
-			fmt.Printf("%s version:%s\n", cli.App.Name, "1.0")
+			fmt.Printf("%s version:%s\n", cli.App.Name, bootstrap.Version)
 			return nil
 		},
 	}
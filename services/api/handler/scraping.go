@@ -7,5 +7,5 @@ import (
 // Test ...
 func (h Contract) Test(w http.ResponseWriter, r *http.Request) {
 
-	h.SendSuccess(w, nil, nil)
+	h.SendSuccessR(w, r, nil, nil)
 }
@@ -1,6 +1,8 @@
 package api
 
 import (
+	"net/http"
+
 	"hypefast-api/bootstrap"
 	"hypefast-api/services/api/handler"
 
@@ -13,6 +15,28 @@ func RegisterRoutes(r *chi.Mux, app *bootstrap.App) {
 		r.Get("/ping", app.PingAction)
 
 		RegisterSubsRoute(r, app)
+		if app.Config.GetBool("server.tls.enabled") && len(app.Config.GetString("server.tls.client_ca_file")) > 0 {
+			RegisterInternalRoutes(r, app)
+		}
+	})
+}
+
+// RegisterInternalRoutes the routes of the internal callers, only served to a verified client certificate
+func RegisterInternalRoutes(r chi.Router, app *bootstrap.App) chi.Router {
+	r.Route("/internal", func(r chi.Router) {
+		r.Use(app.RequireClientCert)
+
+		r.Get("/ping", app.PingAction)
+	})
+
+	return r
+}
+
+// RegisterHealthRoutes the probes on the public port, only used when there is no admin listener
+func RegisterHealthRoutes(r chi.Router, app *bootstrap.App) {
+	r.Route("/health", func(r chi.Router) {
+		r.Get("/live", app.LiveAction)
+		r.Get("/ready", app.PublicReadyAction)
 	})
 }
 
@@ -20,9 +44,26 @@ func RegisterRoutes(r *chi.Mux, app *bootstrap.App) {
 func RegisterSubsRoute(r chi.Router, app *bootstrap.App) chi.Router {
 	h := handler.Contract{App: app}
 	r.Route("/api", func(r chi.Router) {
+		r.Use(app.HeaderCheckerMiddleware)
+		if app.Config.GetBool("signature.enabled") {
+			r.Use(app.SignatureMiddleware)
+		}
+		if app.Config.GetBool("idempotency.enabled") {
+			r.Use(app.IdempotencyMiddleware)
+		}
 
-		r.Get("/", h.Test)
+		r.With(cacheResponse(app, "api")).Get("/", h.Test)
 	})
 
 	return r
 }
+
+// cacheResponse cache the GET responses of a route for `cache.http_ttl`, nothing is cached without it
+func cacheResponse(app *bootstrap.App, tags ...string) func(http.Handler) http.Handler {
+	ttl := app.Config.GetDuration("cache.http_ttl")
+	if ttl <= 0 {
+		return func(next http.Handler) http.Handler { return next }
+	}
+
+	return app.CacheMiddleware(ttl, tags...)
+}
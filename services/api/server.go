@@ -0,0 +1,249 @@
+package api
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"hypefast-api/lib/utils"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+const (
+	dflReadHeaderTimeout = 10 * time.Second
+	dflReadTimeout       = 30 * time.Second
+	dflIdleTimeout       = 120 * time.Second
+
+	// certCheckInterval how often the certificate files are checked for a change
+	certCheckInterval = 10 * time.Second
+)
+
+// newAdminServer build the plain http server of the admin listener with the timeouts from the `server` config.
+// There is no write timeout since a CPU profile may take longer.
+func newAdminServer(config utils.Config, addr string, handler http.Handler) *http.Server {
+	return &http.Server{
+		Addr:              addr,
+		Handler:           handler,
+		ReadHeaderTimeout: durationOr(config, "server.read_header_timeout", dflReadHeaderTimeout),
+		ReadTimeout:       durationOr(config, "server.read_timeout", dflReadTimeout),
+		IdleTimeout:       durationOr(config, "server.idle_timeout", dflIdleTimeout),
+		MaxHeaderBytes:    http.DefaultMaxHeaderBytes,
+	}
+}
+
+// newServer build the http server of addr with the timeouts from the `server` config.
+// When `server.tls.enabled` the certificate is served from `server.tls.cert_file` and `server.tls.key_file`
+// (reloaded when they change), otherwise HTTP/2 without TLS (h2c) can be enabled with `server.h2c`.
+// There is no write timeout unless `server.write_timeout` is set, it would cut the long streams (RenderStream).
+func newServer(config utils.Config, addr string, handler http.Handler) (*http.Server, error) {
+	srv := &http.Server{
+		Addr:              addr,
+		Handler:           handler,
+		ReadHeaderTimeout: durationOr(config, "server.read_header_timeout", dflReadHeaderTimeout),
+		ReadTimeout:       durationOr(config, "server.read_timeout", dflReadTimeout),
+		WriteTimeout:      config.GetDuration("server.write_timeout"),
+		IdleTimeout:       durationOr(config, "server.idle_timeout", dflIdleTimeout),
+		MaxHeaderBytes:    http.DefaultMaxHeaderBytes,
+	}
+	if maxHeader := config.GetInt("server.max_header_bytes"); maxHeader > 0 {
+		srv.MaxHeaderBytes = maxHeader
+	}
+
+	if !config.GetBool("server.tls.enabled") {
+		if config.GetBool("server.h2c") {
+			srv.Handler = h2c.NewHandler(handler, &http2.Server{IdleTimeout: srv.IdleTimeout})
+		}
+
+		return srv, nil
+	}
+
+	tlsConfig, err := newTLSConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	srv.TLSConfig = tlsConfig
+
+	// custom TLSConfig disables the automatic HTTP/2 of net/http
+	if err := http2.ConfigureServer(srv, &http2.Server{IdleTimeout: srv.IdleTimeout}); err != nil {
+		return nil, err
+	}
+
+	return srv, nil
+}
+
+// listenAndServe serve with TLS when the server has a TLS config
+func listenAndServe(srv *http.Server) error {
+	if srv.TLSConfig != nil {
+		// the certificate is given by TLSConfig.GetCertificate
+		return srv.ListenAndServeTLS("", "")
+	}
+
+	return srv.ListenAndServe()
+}
+
+func durationOr(config utils.Config, key string, dfl time.Duration) time.Duration {
+	if d := config.GetDuration(key); d > 0 {
+		return d
+	}
+
+	return dfl
+}
+
+// newTLSConfig build the TLS config of the server.
+// `server.tls.client_ca_file` enable mutual TLS, `server.tls.client_auth` decide
+// whether the client certificate is only verified when given ("verify_if_given", the default) or required ("require").
+// With "verify_if_given" the public callers still connect without a certificate, the internal routes
+// check it with RequireClientCert.
+func newTLSConfig(config utils.Config) (*tls.Config, error) {
+	reloader, err := newCertReloader(
+		config.GetString("server.tls.cert_file"),
+		config.GetString("server.tls.key_file"),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: reloader.GetCertificate,
+	}
+
+	caFile := config.GetString("server.tls.client_ca_file")
+	if len(caFile) == 0 {
+		return tlsConfig, nil
+	}
+
+	caPEM, err := ioutil.ReadFile(caFile)
+	if err != nil {
+		return nil, err
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(caPEM) {
+		return nil, fmt.Errorf("no certificate found in %s", caFile)
+	}
+	tlsConfig.ClientCAs = pool
+
+	switch config.GetString("server.tls.client_auth") {
+	case "verify_if_given", "":
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	case "require":
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	default:
+		return nil, fmt.Errorf("unknown server.tls.client_auth %q", config.GetString("server.tls.client_auth"))
+	}
+
+	return tlsConfig, nil
+}
+
+// certReloader give the server certificate and load it again when the files change,
+// so a renewed certificate is served without restarting the app.
+type certReloader struct {
+	certFile string
+	keyFile  string
+
+	mu        sync.RWMutex
+	cert      *tls.Certificate
+	modTime   time.Time
+	checkedAt time.Time
+}
+
+func newCertReloader(certFile, keyFile string) (*certReloader, error) {
+	if len(certFile) == 0 || len(keyFile) == 0 {
+		return nil, fmt.Errorf("server.tls.cert_file and server.tls.key_file are required")
+	}
+
+	c := &certReloader{certFile: certFile, keyFile: keyFile}
+	modTime, err := c.lastModified()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := c.load(modTime); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// GetCertificate implement tls.Config.GetCertificate
+func (c *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.mu.RLock()
+	cert, due := c.cert, time.Since(c.checkedAt) > certCheckInterval
+	c.mu.RUnlock()
+
+	if due {
+		c.maybeReload()
+
+		c.mu.RLock()
+		cert = c.cert
+		c.mu.RUnlock()
+	}
+
+	return cert, nil
+}
+
+func (c *certReloader) maybeReload() {
+	modTime, err := c.lastModified()
+
+	c.mu.Lock()
+	c.checkedAt = time.Now()
+	changed := err == nil && modTime.After(c.modTime)
+	c.mu.Unlock()
+
+	if err != nil {
+		log.Printf("[tls] %v", err)
+		return
+	}
+
+	if changed {
+		if err := c.load(modTime); err != nil {
+			// keep serving the previous certificate
+			log.Printf("[tls] reload certificate: %v", err)
+			return
+		}
+		log.Printf("[tls] certificate %s reloaded", c.certFile)
+	}
+}
+
+func (c *certReloader) load(modTime time.Time) error {
+	cert, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.cert = &cert
+	c.modTime = modTime
+	c.checkedAt = time.Now()
+
+	return nil
+}
+
+// lastModified the latest modification time of the certificate and key files
+func (c *certReloader) lastModified() (time.Time, error) {
+	certStat, err := os.Stat(c.certFile)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	keyStat, err := os.Stat(c.keyFile)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	if keyStat.ModTime().After(certStat.ModTime()) {
+		return keyStat.ModTime(), nil
+	}
+
+	return certStat.ModTime(), nil
+}
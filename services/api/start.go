@@ -2,22 +2,24 @@ package api
 
 import (
 	"context"
-	"fmt"
 	"hypefast-api/bootstrap"
 	"hypefast-api/lib/psql"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/go-chi/chi"
 	"github.com/go-chi/chi/middleware"
-	"github.com/go-chi/cors"
 	"github.com/go-chi/valve"
 	"github.com/urfave/cli/v2"
 )
 
+// dflShutdownTimeout how long the in-flight requests are waited on shutdown
+const dflShutdownTimeout = 20 * time.Second
+
 // Boot ...
 type Boot struct {
 	*bootstrap.App
@@ -44,6 +46,16 @@ func (app Boot) Start(c *cli.Context) error {
 		panic(err)
 	}
 	app.App.DB = db
+	app.RegisterStorageValidators()
+
+	metricsEnabled := app.Config.GetBool("metrics.enabled")
+	if metricsEnabled {
+		app.InstrumentStorage()
+	}
+	if app.Tracing != nil {
+		app.InstrumentTracing()
+	}
+	app.SetupHealth()
 
 	host := c.String("host")
 	if len(host) == 0 {
@@ -59,59 +71,129 @@ func (app Boot) Start(c *cli.Context) error {
 
 	// start new app
 	r := chi.NewRouter()
-	cors := cors.New(cors.Options{
-		AllowedOrigins: []string{"*"},
-		AllowedMethods: []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowedHeaders: []string{
-			"Accept",
-			"Authorization",
-			"Content-Type",
-			"X-CSRF-Token",
-			"X-SIGNATURE",
-			"X-TIMESTAMPT",
-			"X-CHANNEL",
-		},
-		ExposedHeaders:   []string{"Link"},
-		AllowCredentials: true,
-		MaxAge:           300,
-	})
-	r.Use(cors.Handler)
+	r.Use(app.RealIPMiddleware)
+	if app.Tracing != nil {
+		r.Use(app.TracingMiddleware)
+	}
+	r.Use(app.CorsMiddleware())
+	if app.Config.GetBool("compress.enabled") {
+		r.Use(app.CompressMiddleware())
+	}
+	if metricsEnabled {
+		r.Use(app.NewPrometPatternMiddleware(serviceName(app.App)))
+	}
 	if app.Debug {
 		r.Use(middleware.Logger)
 	}
+	r.Use(app.LocaleMiddleware)
+	r.Use(app.NegotiateProblemMiddleware)
 	r.Use(app.Recoverer)
+	r.Use(app.ValveMiddleware)
 	r.Use(app.NotfoundMiddleware)
+	r.Use(app.ConditionalMiddleware)
+	r.Use(app.RequestBodyMiddleware)
+	r.Use(app.TimeoutMiddleware)
+	if app.Config.GetBool("rate_limit.enabled") {
+		r.Use(app.RateLimitMiddleware)
+	}
 
 	RegisterRoutes(r, app.App)
 
+	// operational endpoints are served on the admin listener, away from the public port
+	adminAddr := app.Config.GetString("admin.addr")
+	if len(adminAddr) == 0 {
+		adminAddr = app.Config.GetString("metrics.addr")
+	}
+	if len(adminAddr) == 0 {
+		RegisterHealthRoutes(r, app.App)
+	}
+
 	// handle gracefull shutdown
-	srv := http.Server{Addr: host, Handler: chi.ServerBaseContext(baseCtx, r)}
+	srv, err := newServer(app.Config, host, chi.ServerBaseContext(baseCtx, r))
+	if err == nil {
+		err = app.CheckTimeouts(srv.WriteTimeout)
+	}
+	if err != nil {
+		app.App.Close(context.Background())
+		return err
+	}
+
+	var adminSrv *http.Server
+	if len(adminAddr) > 0 {
+		adminSrv = newAdminServer(app.Config, adminAddr, app.AdminHandler())
+		go func() {
+			if err := adminSrv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				log.Printf("[admin] %v", err)
+			}
+		}()
+	}
+
 	sng := make(chan os.Signal, 1)
-	signal.Notify(sng, os.Interrupt)
+	signal.Notify(sng, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(sng)
+
+	srvErr := make(chan error, 1)
+	go func() {
+		srvErr <- listenAndServe(srv)
+	}()
 
-	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	select {
+	case err = <-srvErr:
+		// the server can't listen, nothing to drain
+		app.App.Close(context.Background())
+		return err
+	case sig := <-sng:
+		log.Printf("%v received, shutting down..", sig)
+	}
+
+	return app.shutdown(valv, srv, adminSrv)
+}
+
+// shutdown drain the servers and release the resources of the app:
+// readiness starts failing, then after the pre-stop delay (so the load balancer stops routing)
+// the long handlers holding the valve and the in-flight requests are waited until the timeout.
+func (app Boot) shutdown(valv *valve.Valve, srv, adminSrv *http.Server) error {
+	timeout := app.Config.GetDuration("app.shutdown.timeout")
+	if timeout <= 0 {
+		timeout = dflShutdownTimeout
+	}
+
+	app.Health.SetShuttingDown()
+	if delay := app.Config.GetDuration("app.shutdown.pre_stop_delay"); delay > 0 {
+		log.Printf("waiting %v before draining the connections..", delay)
+		time.Sleep(delay)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
 	defer cancel()
 
-	go func() {
-		for range sng {
-			fmt.Println("shutting down..")
-			err = valv.Shutdown(20 * time.Second)
-			if err != nil {
-				log.Println("Can't shutdown this server until all process are done!")
-			}
+	var drainErr error
+	if err := valv.Shutdown(timeout); err != nil {
+		log.Println("Can't shutdown this server until all process are done!")
+		drainErr = err
+	}
 
-			err = srv.Shutdown(ctx)
-			if err != nil {
-				log.Println("Can't shutdown this server until all process are done!")
-			}
-			select {
-			case <-time.After(21 * time.Second):
-				fmt.Println("not all connections done")
-			case <-ctx.Done():
+	if err := srv.Shutdown(ctx); err != nil {
+		log.Println("not all connections done")
+		drainErr = err
+	}
 
-			}
-		}
-	}()
+	// the admin listener goes last, so the probes and metrics stay available while draining
+	if adminSrv != nil {
+		_ = adminSrv.Shutdown(ctx)
+	}
+
+	app.App.Close(ctx)
+
+	return drainErr
+}
+
+// serviceName name of the service that labelled into the metrics
+func serviceName(app *bootstrap.App) string {
+	name := app.Config.GetString("app.name")
+	if len(name) == 0 {
+		name = "hypefast-api"
+	}
 
-	return srv.ListenAndServe()
+	return name
 }